@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -9,14 +10,26 @@ import (
 type CacheEntry struct {
 	Body      []byte
 	ETag      string
+	CreatedAt time.Time
 	ExpiresAt time.Time
+
+	// UpstreamETag is the ETag the upstream sent with Body, used to revalidate the entry
+	UpstreamETag string
 }
 
+// ChangeHook is called after Set stores content that differs from the previous
+// entry for the key; previous is nil when the key had no entry
+type ChangeHook func(key string, previous *CacheEntry, current CacheEntry)
+
 // Cache provides in-memory caching with TTL
 type Cache struct {
-	mu      sync.RWMutex
-	entries map[string]*CacheEntry
-	ttl     time.Duration
+	mu       sync.RWMutex
+	entries  map[string]*CacheEntry
+	ttl      time.Duration
+	onChange ChangeHook
+	maxBytes int
+	size     int
+	maxAge   time.Duration
 }
 
 // NewCache creates a new cache with the specified TTL
@@ -29,42 +42,215 @@ func NewCache(ttl time.Duration) *Cache {
 
 // Get retrieves a cached entry if it exists and is not expired
 func (c *Cache) Get(key string) (body []byte, etag string, found bool) {
+	entry, found := c.GetEntry(key)
+	return entry.Body, entry.ETag, found
+}
+
+// GetStale retrieves a cached entry even if expired (for stale-on-error)
+func (c *Cache) GetStale(key string) (body []byte, etag string, found bool) {
+	entry, found := c.GetStaleEntry(key)
+	return entry.Body, entry.ETag, found
+}
+
+// GetEntry retrieves a copy of a cached entry if it exists and is not expired
+func (c *Cache) GetEntry(key string) (CacheEntry, bool) {
+	entry, found := c.GetStaleEntry(key)
+	if !found || time.Now().After(entry.ExpiresAt) {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+// GetStaleEntry retrieves a copy of a cached entry even if expired
+func (c *Cache) GetStaleEntry(key string) (CacheEntry, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	entry, exists := c.entries[key]
 	if !exists {
-		return nil, "", false
+		return CacheEntry{}, false
 	}
 
-	if time.Now().After(entry.ExpiresAt) {
-		return nil, "", false
+	return *entry, true
+}
+
+// SetChangeHook registers a hook called whenever Set changes the content stored for a key
+func (c *Cache) SetChangeHook(hook ChangeHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onChange = hook
+}
+
+// Set stores a value in the cache with TTL and returns a copy of the stored entry
+func (c *Cache) Set(key string, body []byte, etag string) CacheEntry {
+	return c.SetAt(key, body, etag, time.Now(), "")
+}
+
+// SetAt stores an entry whose content was generated at createdAt, so its age and
+// expiry are measured from that time rather than from now. upstreamETag, if known,
+// allows the entry to be revalidated later.
+func (c *Cache) SetAt(key string, body []byte, etag string, createdAt time.Time, upstreamETag string) CacheEntry {
+	c.mu.Lock()
+
+	entry := &CacheEntry{
+		Body:         body,
+		ETag:         etag,
+		CreatedAt:    createdAt,
+		ExpiresAt:    createdAt.Add(c.ttl),
+		UpstreamETag: upstreamETag,
+	}
+	previous := c.entries[key]
+
+	// Refuse entries that could never fit the byte budget; the caller still serves the returned
+	// copy. The previous body is superseded, so it is dropped rather than served as stale.
+	if c.maxBytes > 0 && len(body) > c.maxBytes {
+		if previous != nil {
+			c.size -= len(previous.Body)
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		slog.Warn("cache_rejected", "key", key, "bytes", len(body), "max_bytes", c.maxBytes)
+		return *entry
+	}
+
+	if previous != nil {
+		c.size -= len(previous.Body)
+		delete(c.entries, key)
 	}
+	c.evictUntilFits(len(body))
+	c.entries[key] = entry
+	c.size += len(body)
+	hook := c.onChange
+
+	c.mu.Unlock()
 
-	return entry.Body, entry.ETag, true
+	// Notify outside the lock so the hook may read the cache
+	if hook != nil && (previous == nil || previous.ETag != etag) {
+		hook(key, previous, *entry)
+	}
+
+	return *entry
 }
 
-// GetStale retrieves a cached entry even if expired (for stale-on-error)
-func (c *Cache) GetStale(key string) (body []byte, etag string, found bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// Renew restarts the freshness of an existing entry whose content the upstream confirmed
+// is unchanged, measuring its age and expiry from createdAt. It reports false if the key
+// has no entry.
+func (c *Cache) Renew(key string, createdAt time.Time) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	entry, exists := c.entries[key]
 	if !exists {
-		return nil, "", false
+		return CacheEntry{}, false
 	}
 
-	return entry.Body, entry.ETag, true
+	entry.CreatedAt = createdAt
+	entry.ExpiresAt = createdAt.Add(c.ttl)
+	return *entry, true
 }
 
-// Set stores a value in the cache with TTL
-func (c *Cache) Set(key string, body []byte, etag string) {
+// Delete removes the entry for key, if any
+func (c *Cache) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.entries[key] = &CacheEntry{
-		Body:      body,
-		ETag:      etag,
-		ExpiresAt: time.Now().Add(c.ttl),
+	if entry, exists := c.entries[key]; exists {
+		c.size -= len(entry.Body)
+		delete(c.entries, key)
+	}
+}
+
+// Clear removes all entries from the cache
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*CacheEntry)
+	c.size = 0
+}
+
+// Snapshot returns copies of all cached entries, expired or not, keyed by cache key
+func (c *Cache) Snapshot() map[string]CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]CacheEntry, len(c.entries))
+	for key, entry := range c.entries {
+		snapshot[key] = *entry
+	}
+
+	return snapshot
+}
+
+// SetMaxBytes sets the budget for the total size of cached bodies; zero means unlimited
+func (c *Cache) SetMaxBytes(maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxBytes = maxBytes
+}
+
+// SetSlidingExpiration makes Touch extend entries up to maxAge after their creation;
+// zero disables sliding expiration
+func (c *Cache) SetSlidingExpiration(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxAge = maxAge
+}
+
+// Touch extends the expiry of a fresh entry to one TTL from now, but never beyond the
+// sliding expiration cap measured from its creation, and returns a copy of the entry.
+// It reports false if the key has no fresh entry.
+func (c *Cache) Touch(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	now := time.Now()
+	if !exists || now.After(entry.ExpiresAt) {
+		return CacheEntry{}, false
+	}
+
+	if c.maxAge > 0 {
+		expiresAt := now.Add(c.ttl)
+		if limit := entry.CreatedAt.Add(c.maxAge); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+		if expiresAt.After(entry.ExpiresAt) {
+			entry.ExpiresAt = expiresAt
+		}
+	}
+	return *entry, true
+}
+
+// Size returns the total size in bytes of all cached bodies
+func (c *Cache) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.size
+}
+
+// evictUntilFits removes the oldest entries until an entry of the given size fits
+// the byte budget. The caller must hold the write lock.
+func (c *Cache) evictUntilFits(incoming int) {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	for c.size+incoming > c.maxBytes && len(c.entries) > 0 {
+		var oldestKey string
+		var oldest *CacheEntry
+		for key, entry := range c.entries {
+			if oldest == nil || entry.CreatedAt.Before(oldest.CreatedAt) {
+				oldestKey, oldest = key, entry
+			}
+		}
+
+		delete(c.entries, oldestKey)
+		c.size -= len(oldest.Body)
+		slog.Info("cache_evict", "key", oldestKey, "reason", "size", "bytes", len(oldest.Body), "remaining_entries", len(c.entries))
 	}
 }
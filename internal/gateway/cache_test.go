@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -116,4 +117,189 @@ func TestCache(t *testing.T) {
 			t.Error("Expected GetStale to return false for non-existent key")
 		}
 	})
+	t.Run("Set records creation time", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		before := time.Now()
+
+		stored := cache.Set("test-key", []byte(`{}`), `"etag"`)
+
+		entry, found := cache.GetEntry("test-key")
+		if !found {
+			t.Fatal("Expected cache hit after Set")
+		}
+		if entry.CreatedAt.Before(before) {
+			t.Errorf("Expected CreatedAt at or after %v, got %v", before, entry.CreatedAt)
+		}
+		if !entry.CreatedAt.Equal(stored.CreatedAt) {
+			t.Errorf("Expected returned entry to match stored entry")
+		}
+		if !entry.ExpiresAt.Equal(entry.CreatedAt.Add(60 * time.Second)) {
+			t.Errorf("Expected ExpiresAt to be CreatedAt plus TTL")
+		}
+	})
+	t.Run("Change hook fires only when content changes", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		var calls []string
+		cache.SetChangeHook(func(key string, previous *CacheEntry, current CacheEntry) {
+			previousETag := "none"
+			if previous != nil {
+				previousETag = previous.ETag
+			}
+			calls = append(calls, previousETag+"->"+current.ETag)
+		})
+
+		cache.Set("test-key", []byte(`{"v":1}`), `"v1"`)
+		cache.Set("test-key", []byte(`{"v":1}`), `"v1"`)
+		cache.Set("test-key", []byte(`{"v":2}`), `"v2"`)
+
+		expected := []string{`none->"v1"`, `"v1"->"v2"`}
+		if len(calls) != len(expected) {
+			t.Fatalf("Expected %d hook calls, got %d: %v", len(expected), len(calls), calls)
+		}
+		for i := range expected {
+			if calls[i] != expected[i] {
+				t.Errorf("Call %d: expected %s, got %s", i, expected[i], calls[i])
+			}
+		}
+	})
+	t.Run("Clear removes all entries", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.Set("a", []byte("1"), `"1"`)
+		cache.Set("b", []byte("2"), `"2"`)
+
+		cache.Clear()
+
+		if _, found := cache.GetStaleEntry("a"); found {
+			t.Error("Expected a to be cleared")
+		}
+		if _, found := cache.GetStaleEntry("b"); found {
+			t.Error("Expected b to be cleared")
+		}
+	})
+	t.Run("Delete removes one entry and its size", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.Set("a", []byte("111"), `"1"`)
+		cache.Set("b", []byte("22"), `"2"`)
+
+		cache.Delete("a")
+		cache.Delete("missing")
+
+		if _, found := cache.GetStaleEntry("a"); found {
+			t.Error("Expected a to be deleted")
+		}
+		if _, found := cache.GetStaleEntry("b"); !found {
+			t.Error("Expected b to be kept")
+		}
+		if cache.Size() != 2 {
+			t.Errorf("Expected size 2, got %d", cache.Size())
+		}
+	})
+
+	t.Run("Byte budget evicts the oldest entries", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.SetMaxBytes(10)
+		buf := captureLogs(t)
+
+		cache.Set("a", []byte("aaaaaa"), `"a"`)
+		cache.Set("b", []byte("bbbbbb"), `"b"`)
+
+		if _, found := cache.GetStaleEntry("a"); found {
+			t.Error("Expected oldest entry to be evicted")
+		}
+		if _, found := cache.GetStaleEntry("b"); !found {
+			t.Error("Expected newest entry to be cached")
+		}
+		if cache.Size() != 6 {
+			t.Errorf("Expected size 6, got %d", cache.Size())
+		}
+		if !strings.Contains(buf.String(), "cache_evict key=a reason=size") {
+			t.Errorf("Expected eviction log, got %s", buf.String())
+		}
+	})
+
+	t.Run("Entries larger than the budget are rejected", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.SetMaxBytes(10)
+		captureLogs(t)
+
+		cache.Set("small", []byte("12345"), `"s"`)
+		entry := cache.Set("large", []byte("0123456789abcdef"), `"l"`)
+
+		if string(entry.Body) != "0123456789abcdef" {
+			t.Error("Expected rejected entry to still be returned to the caller")
+		}
+		if _, found := cache.GetStaleEntry("large"); found {
+			t.Error("Expected oversized entry to be rejected")
+		}
+		if _, found := cache.GetStaleEntry("small"); !found {
+			t.Error("Expected existing entry to be kept")
+		}
+
+		cache.Set("small", []byte("0123456789abcdef"), `"l"`)
+		if body, _, found := cache.GetStale("small"); found {
+			t.Errorf("Expected the superseded entry to be dropped, got %s", body)
+		}
+		if cache.Size() != 0 {
+			t.Errorf("Expected size 0 after dropping the superseded entry, got %d", cache.Size())
+		}
+	})
+
+	t.Run("Replacing an entry adjusts the size", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.SetMaxBytes(10)
+
+		cache.Set("a", []byte("aaaaaaaa"), `"1"`)
+		cache.Set("a", []byte("aaaaaaaaa"), `"2"`)
+
+		if cache.Size() != 9 {
+			t.Errorf("Expected size 9, got %d", cache.Size())
+		}
+		if _, found := cache.GetStaleEntry("a"); !found {
+			t.Error("Expected replaced entry to be cached")
+		}
+	})
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	t.Run("Touch extends the expiry by the TTL", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.SetSlidingExpiration(time.Hour)
+		cache.SetAt("key", []byte("body"), `"e"`, time.Now().Add(-50*time.Second), "")
+
+		entry, found := cache.Touch("key")
+		if !found {
+			t.Fatal("Expected fresh entry")
+		}
+		if remaining := time.Until(entry.ExpiresAt); remaining < 55*time.Second {
+			t.Errorf("Expected the expiry to slide to about a TTL from now, got %v remaining", remaining)
+		}
+	})
+
+	t.Run("Touch never extends past the absolute age", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		cache.SetSlidingExpiration(90 * time.Second)
+		createdAt := time.Now().Add(-50 * time.Second)
+		cache.SetAt("key", []byte("body"), `"e"`, createdAt, "")
+
+		entry, _ := cache.Touch("key")
+		if !entry.ExpiresAt.Equal(createdAt.Add(90 * time.Second)) {
+			t.Errorf("Expected expiry capped at %v, got %v", createdAt.Add(90*time.Second), entry.ExpiresAt)
+		}
+
+		// Once the cap is reached the entry expires however often it is touched
+		cache.entries["key"].ExpiresAt = time.Now().Add(-time.Second)
+		if _, found := cache.Touch("key"); found {
+			t.Error("Expected an expired entry not to be revived")
+		}
+	})
+
+	t.Run("Touch without sliding expiration leaves the expiry alone", func(t *testing.T) {
+		cache := NewCache(60 * time.Second)
+		stored := cache.SetAt("key", []byte("body"), `"e"`, time.Now().Add(-50*time.Second), "")
+
+		entry, found := cache.Touch("key")
+		if !found || !entry.ExpiresAt.Equal(stored.ExpiresAt) {
+			t.Errorf("Expected unchanged expiry %v, got %v", stored.ExpiresAt, entry.ExpiresAt)
+		}
+	})
 }
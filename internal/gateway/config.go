@@ -2,35 +2,223 @@ package gateway
 
 import (
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// FailModeOpen returns 502 Bad Gateway when neither cache nor upstream can serve a request
+	FailModeOpen = "open"
+	// FailModeClosed returns 503 Service Unavailable when neither cache nor upstream can serve a request
+	FailModeClosed = "closed"
+
+	// ErrorFormatText writes error responses as plain text
+	ErrorFormatText = "text"
+	// ErrorFormatProblem writes error responses as RFC 7807 application/problem+json
+	ErrorFormatProblem = "problem"
+
+	// LogFormatText writes logs as logfmt-style key=value lines
+	LogFormatText = "text"
+	// LogFormatJSON writes logs as one JSON object per line
+	LogFormatJSON = "json"
+
+	// OptionsModeAllow answers OPTIONS requests with 204 and an Allow header
+	OptionsModeAllow = "allow"
+	// OptionsModeReject rejects OPTIONS requests with 405
+	OptionsModeReject = "reject"
+
+	// EndpointDiscovery names the OIDC discovery endpoint in ENABLED_ENDPOINTS
+	EndpointDiscovery = "discovery"
+	// EndpointJWKS names the JWKS endpoint in ENABLED_ENDPOINTS
+	EndpointJWKS = "jwks"
+)
+
 // Config holds all application configuration
 type Config struct {
-	ListenAddr              string
-	ListenPort              string
-	UpstreamHost            string
-	UpstreamTimeoutSeconds  int
-	CacheTTLSeconds         int
-	ClientCacheTTLSeconds   int
-	PrettyPrintJSON         bool
-	SATokenPath             string
-	SACACertPath            string
+	// Version is the application version, set by main rather than the environment
+	Version string
+
+	ListenAddr                       string
+	ListenPort                       string
+	SecondaryListenPort              string
+	MaxURLLength                     int
+	DeprecatedPaths                  []string
+	AllowedHosts                     []string
+	TCPKeepAliveSeconds              int
+	ListenBacklog                    int
+	ListenAfterWarmup                bool
+	WarmupTimeoutSeconds             int
+	WarmupBackoffInitialMS           int
+	WarmupBackoffMaxMS               int
+	RejectUntilWarm                  bool
+	UpstreamHost                     string
+	UpstreamTimeoutSeconds           int
+	UpstreamMaxConcurrency           int
+	UpstreamMaxConcurrencyPerPath    int
+	UpstreamQPS                      float64
+	UpstreamBurst                    int
+	UpstreamHeaders                  []string
+	PropagateRequestID               bool
+	RequestBudgetMS                  int
+	UpstreamDNSCacheTTLSeconds       int
+	PinUpstreamIP                    bool
+	CacheTTLSeconds                  int
+	UpstreamDateFreshness            bool
+	ConditionalUpstreamRequests      bool
+	SlidingExpiration                bool
+	MaxAbsoluteAgeSeconds            int
+	ClientCacheTTLSeconds            int
+	ExpiresSkewSeconds               int
+	AtomicOIDCRefresh                bool
+	OIDCRefreshSkewSeconds           int
+	DiscoveryUpstreamQuery           string
+	JWKSUpstreamQuery                string
+	MaxCacheBytes                    int
+	CacheIntegrityIntervalSeconds    int
+	HonorClientNoCache               bool
+	PrettyPrintJSON                  bool
+	DiscoveryContentType             string
+	DiscoveryTemplate                string
+	PublicIssuerURL                  string
+	PublicBaseURL                    string
+	DiscoveryYAMLEnabled             bool
+	JWKSContentType                  string
+	CanonicalizeJSON                 bool
+	PrettyPrintFallbackPassthrough   bool
+	MinJWKSKeys                      int
+	ValidateKeyMaterial              bool
+	SortJWKSKeys                     bool
+	AuditKeyChanges                  bool
+	SATokenPath                      string
+	SACACertPath                     string
+	SACACertPaths                    []string
+	SeedDiscoveryFile                string
+	SeedJWKSFile                     string
+	BootstrapDiscoveryJSON           string
+	DegradedStart                    bool
+	ErrorLogDedupWindowSeconds       int
+	UpstreamErrorEscalationThreshold int
+	StatsLogIntervalSeconds          int
+	StatsDAddr                       string
+	StatsDPrefix                     string
+	StatsDFlushIntervalMS            int
+	LogSampleRate                    int
+	SlowRequestThresholdMS           int
+	FailMode                         string
+	StaleOnUpstreamStatuses          []string
+	CacheOnly                        bool
+	CacheOnlyFile                    string
+	TLSSessionCacheSize              int
+	CheckJWKSConsistency             bool
+	ErrorFormat                      string
+	LogFormat                        string
+	LogLevel                         string
+	DebugAuthToken                   string
+	DebugHeaders                     bool
+	CacheStatusHeader                bool
+	StaleWarningHeader               bool
+	CacheSnapshotEnabled             bool
+	StatusEndpointEnabled            bool
+	StatsEndpointEnabled             bool
+	MetricsEnabled                   bool
+	OptionsMode                      string
+	EnabledEndpoints                 []string
+	DependencyHealthURL              string
+	DependencyHealthTimeoutSeconds   int
 }
 
 // LoadConfig loads configuration from environment variables with safe defaults
 func LoadConfig() *Config {
 	return &Config{
-		ListenAddr:             getEnv("LISTEN_ADDR", "0.0.0.0"),
-		ListenPort:             getEnv("LISTEN_PORT", "8080"),
-		UpstreamHost:           getEnv("UPSTREAM_HOST", "https://kubernetes.default.svc"),
-		UpstreamTimeoutSeconds: getEnvAsInt("UPSTREAM_TIMEOUT_SECONDS", 5),
-		CacheTTLSeconds:        getEnvAsInt("CACHE_TTL_SECONDS", 60),
-		ClientCacheTTLSeconds:  getEnvAsInt("CLIENT_CACHE_TTL_SECONDS", 3600),
-		PrettyPrintJSON:        getEnvAsBool("PRETTY_PRINT_JSON", true),
-		SATokenPath:            getEnv("SA_TOKEN_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
-		SACACertPath:           getEnv("SA_CA_CERT_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"),
+		ListenAddr:                       getEnv("LISTEN_ADDR", "0.0.0.0"),
+		ListenPort:                       getEnv("LISTEN_PORT", "8080"),
+		SecondaryListenPort:              getEnv("SECONDARY_LISTEN_PORT", ""),
+		MaxURLLength:                     getEnvAsInt("MAX_URL_LENGTH", 0),
+		DeprecatedPaths:                  getEnvAsList("DEPRECATED_PATHS"),
+		AllowedHosts:                     getEnvAsList("ALLOWED_HOSTS"),
+		TCPKeepAliveSeconds:              getEnvAsInt("TCP_KEEPALIVE_SECONDS", 0),
+		ListenBacklog:                    getEnvAsInt("LISTEN_BACKLOG", 0),
+		ListenAfterWarmup:                getEnvAsBool("LISTEN_AFTER_WARMUP", false),
+		WarmupTimeoutSeconds:             getEnvAsInt("WARMUP_TIMEOUT_SECONDS", 60),
+		WarmupBackoffInitialMS:           getEnvAsInt("WARMUP_BACKOFF_INITIAL_MS", 1000),
+		WarmupBackoffMaxMS:               getEnvAsInt("WARMUP_BACKOFF_MAX_MS", 30000),
+		RejectUntilWarm:                  !getEnvAsBool("SERVE_DURING_WARMUP", true),
+		UpstreamHost:                     getEnv("UPSTREAM_HOST", "https://kubernetes.default.svc"),
+		UpstreamTimeoutSeconds:           getEnvAsInt("UPSTREAM_TIMEOUT_SECONDS", 5),
+		UpstreamMaxConcurrency:           getEnvAsInt("UPSTREAM_MAX_CONCURRENCY", 0),
+		UpstreamMaxConcurrencyPerPath:    getEnvAsInt("UPSTREAM_MAX_CONCURRENCY_PER_PATH", 0),
+		UpstreamQPS:                      getEnvAsFloat("UPSTREAM_QPS", 0),
+		UpstreamBurst:                    getEnvAsInt("UPSTREAM_BURST", 1),
+		UpstreamHeaders:                  getEnvAsList("UPSTREAM_HEADERS"),
+		PropagateRequestID:               getEnvAsBool("PROPAGATE_REQUEST_ID", false),
+		RequestBudgetMS:                  getEnvAsInt("REQUEST_BUDGET_MS", 0),
+		UpstreamDNSCacheTTLSeconds:       getEnvAsInt("UPSTREAM_DNS_CACHE_TTL_SECONDS", 0),
+		PinUpstreamIP:                    getEnvAsBool("PIN_UPSTREAM_IP", false),
+		CacheTTLSeconds:                  getEnvAsInt("CACHE_TTL_SECONDS", 60),
+		UpstreamDateFreshness:            getEnvAsBool("UPSTREAM_DATE_FRESHNESS", false),
+		ConditionalUpstreamRequests:      getEnvAsBool("CONDITIONAL_UPSTREAM_REQUESTS", false),
+		SlidingExpiration:                getEnvAsBool("SLIDING_EXPIRATION", false),
+		MaxAbsoluteAgeSeconds:            getEnvAsInt("MAX_ABSOLUTE_AGE_SECONDS", 3600),
+		ClientCacheTTLSeconds:            getEnvAsInt("CLIENT_CACHE_TTL_SECONDS", 3600),
+		ExpiresSkewSeconds:               getEnvAsInt("EXPIRES_SKEW_SECONDS", 0),
+		AtomicOIDCRefresh:                getEnvAsBool("ATOMIC_OIDC_REFRESH", false),
+		OIDCRefreshSkewSeconds:           getEnvAsInt("OIDC_REFRESH_SKEW_SECONDS", 60),
+		DiscoveryUpstreamQuery:           getEnv("DISCOVERY_UPSTREAM_QUERY", ""),
+		JWKSUpstreamQuery:                getEnv("JWKS_UPSTREAM_QUERY", ""),
+		MaxCacheBytes:                    getEnvAsInt("MAX_CACHE_BYTES", 0),
+		CacheIntegrityIntervalSeconds:    getEnvAsInt("CACHE_INTEGRITY_INTERVAL_SECONDS", 0),
+		HonorClientNoCache:               getEnvAsBool("HONOR_CLIENT_NO_CACHE", false),
+		PrettyPrintJSON:                  getEnvAsBool("PRETTY_PRINT_JSON", true),
+		DiscoveryContentType:             getEnv("DISCOVERY_CONTENT_TYPE", "application/json"),
+		DiscoveryTemplate:                getEnv("DISCOVERY_TEMPLATE", ""),
+		PublicIssuerURL:                  getEnv("PUBLIC_ISSUER_URL", ""),
+		PublicBaseURL:                    getEnv("PUBLIC_BASE_URL", ""),
+		DiscoveryYAMLEnabled:             getEnvAsBool("DISCOVERY_YAML_ENABLED", false),
+		JWKSContentType:                  getEnv("JWKS_CONTENT_TYPE", "application/json"),
+		CanonicalizeJSON:                 getEnvAsBool("CANONICALIZE_JSON", false),
+		PrettyPrintFallbackPassthrough:   getEnvAsBool("PRETTY_PRINT_FALLBACK_PASSTHROUGH", false),
+		MinJWKSKeys:                      getEnvAsInt("MIN_JWKS_KEYS", 1),
+		ValidateKeyMaterial:              getEnvAsBool("VALIDATE_KEY_MATERIAL", false),
+		SortJWKSKeys:                     getEnvAsBool("SORT_JWKS_KEYS", false),
+		AuditKeyChanges:                  getEnvAsBool("AUDIT_KEY_CHANGES", false),
+		SATokenPath:                      getEnv("SA_TOKEN_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+		SACACertPath:                     getEnv("SA_CA_CERT_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"),
+		SACACertPaths:                    getEnvAsList("SA_CA_CERT_PATHS"),
+		SeedDiscoveryFile:                getEnv("SEED_DISCOVERY_FILE", ""),
+		SeedJWKSFile:                     getEnv("SEED_JWKS_FILE", ""),
+		BootstrapDiscoveryJSON:           getEnv("BOOTSTRAP_DISCOVERY_JSON", ""),
+		DegradedStart:                    getEnvAsBool("DEGRADED_START", false),
+		ErrorLogDedupWindowSeconds:       getEnvAsInt("ERROR_LOG_DEDUP_WINDOW_SECONDS", 0),
+		UpstreamErrorEscalationThreshold: getEnvAsInt("UPSTREAM_ERROR_ESCALATION_THRESHOLD", 0),
+		StatsLogIntervalSeconds:          getEnvAsInt("STATS_LOG_INTERVAL_SECONDS", 0),
+		StatsDAddr:                       getEnv("STATSD_ADDR", ""),
+		StatsDPrefix:                     getEnv("STATSD_PREFIX", "kube_oidc_gateway"),
+		StatsDFlushIntervalMS:            getEnvAsInt("STATSD_FLUSH_INTERVAL_MS", 0),
+		LogSampleRate:                    getEnvAsInt("LOG_SAMPLE_RATE", 1),
+		SlowRequestThresholdMS:           getEnvAsInt("SLOW_REQUEST_THRESHOLD_MS", 0),
+		FailMode:                         getEnvAsOneOf("FAIL_MODE", FailModeOpen, FailModeOpen, FailModeClosed),
+		StaleOnUpstreamStatuses:          getEnvAsList("STALE_ON_UPSTREAM_STATUSES"),
+		CacheOnly:                        getEnvAsBool("CACHE_ONLY", false),
+		CacheOnlyFile:                    getEnv("CACHE_ONLY_FILE", ""),
+		TLSSessionCacheSize:              getEnvAsInt("UPSTREAM_TLS_SESSION_CACHE_SIZE", 64),
+		CheckJWKSConsistency:             getEnvAsBool("CHECK_JWKS_CONSISTENCY", false),
+		ErrorFormat:                      getEnvAsOneOf("ERROR_FORMAT", ErrorFormatText, ErrorFormatText, ErrorFormatProblem),
+		LogFormat:                        getEnvAsOneOf("LOG_FORMAT", LogFormatText, LogFormatText, LogFormatJSON),
+		LogLevel:                         getEnvAsOneOf("LOG_LEVEL", "info", "debug", "info", "warn", "error"),
+		DebugAuthToken:                   getEnv("DEBUG_AUTH_TOKEN", ""),
+		DebugHeaders:                     getEnvAsBool("DEBUG_HEADERS", false),
+		CacheStatusHeader:                getEnvAsBool("CACHE_STATUS_HEADER", false),
+		StaleWarningHeader:               getEnvAsBool("STALE_WARNING_HEADER", false),
+		CacheSnapshotEnabled:             getEnvAsBool("CACHE_SNAPSHOT_ENABLED", false),
+		StatusEndpointEnabled:            getEnvAsBool("STATUS_ENDPOINT_ENABLED", false),
+		StatsEndpointEnabled:             getEnvAsBool("STATS_ENDPOINT_ENABLED", false),
+		MetricsEnabled:                   getEnvAsBool("METRICS_ENABLED", false),
+		OptionsMode:                      getEnvAsOneOf("OPTIONS_MODE", OptionsModeReject, OptionsModeAllow, OptionsModeReject),
+		EnabledEndpoints:                 getEnvAsList("ENABLED_ENDPOINTS"),
+		DependencyHealthURL:              getEnv("DEPENDENCY_HEALTH_URL", ""),
+		DependencyHealthTimeoutSeconds:   getEnvAsInt("DEPENDENCY_HEALTH_TIMEOUT_SECONDS", 2),
 	}
 }
 
@@ -44,11 +232,122 @@ func (c *Config) GetClientCacheTTL() time.Duration {
 	return time.Duration(c.ClientCacheTTLSeconds) * time.Second
 }
 
+// GetExpiresSkew returns the clock skew buffer subtracted from the Expires header as a duration
+func (c *Config) GetExpiresSkew() time.Duration {
+	return time.Duration(c.ExpiresSkewSeconds) * time.Second
+}
+
 // GetUpstreamTimeout returns the upstream timeout as a duration
 func (c *Config) GetUpstreamTimeout() time.Duration {
 	return time.Duration(c.UpstreamTimeoutSeconds) * time.Second
 }
 
+// GetUpstreamDNSCacheTTL returns the upstream DNS cache TTL as a duration
+func (c *Config) GetUpstreamDNSCacheTTL() time.Duration {
+	return time.Duration(c.UpstreamDNSCacheTTLSeconds) * time.Second
+}
+
+// GetTCPKeepAlive returns the TCP keep-alive period as a duration
+func (c *Config) GetTCPKeepAlive() time.Duration {
+	return time.Duration(c.TCPKeepAliveSeconds) * time.Second
+}
+
+// GetErrorLogDedupWindow returns the error log deduplication window as a duration
+func (c *Config) GetErrorLogDedupWindow() time.Duration {
+	return time.Duration(c.ErrorLogDedupWindowSeconds) * time.Second
+}
+
+// GetStatsLogInterval returns the periodic stats log interval as a duration
+func (c *Config) GetStatsLogInterval() time.Duration {
+	return time.Duration(c.StatsLogIntervalSeconds) * time.Second
+}
+
+// GetCacheIntegrityInterval returns the interval between cache integrity checks as a duration
+func (c *Config) GetCacheIntegrityInterval() time.Duration {
+	return time.Duration(c.CacheIntegrityIntervalSeconds) * time.Second
+}
+
+// GetRequestBudget returns the total time allowed for handling a cache miss as a duration
+func (c *Config) GetRequestBudget() time.Duration {
+	return time.Duration(c.RequestBudgetMS) * time.Millisecond
+}
+
+// GetStatsDFlushInterval returns the StatsD batching interval as a duration
+func (c *Config) GetStatsDFlushInterval() time.Duration {
+	return time.Duration(c.StatsDFlushIntervalMS) * time.Millisecond
+}
+
+// GetMaxAbsoluteAge returns the cap on sliding expiration as a duration
+func (c *Config) GetMaxAbsoluteAge() time.Duration {
+	return time.Duration(c.MaxAbsoluteAgeSeconds) * time.Second
+}
+
+// GetSlowRequestThreshold returns the latency above which requests are logged as slow as a duration
+func (c *Config) GetSlowRequestThreshold() time.Duration {
+	return time.Duration(c.SlowRequestThresholdMS) * time.Millisecond
+}
+
+// GetWarmupTimeout returns the start-up warm-up timeout as a duration
+func (c *Config) GetWarmupTimeout() time.Duration {
+	return time.Duration(c.WarmupTimeoutSeconds) * time.Second
+}
+
+// GetOIDCRefreshSkew returns the maximum age difference between the cached OIDC documents as a duration
+func (c *Config) GetOIDCRefreshSkew() time.Duration {
+	return time.Duration(c.OIDCRefreshSkewSeconds) * time.Second
+}
+
+// ServesStaleOnStatus reports whether an upstream response with the given status code
+// should fall back to stale cached data. An empty list means every status does.
+func (c *Config) ServesStaleOnStatus(statusCode int) bool {
+	return len(c.StaleOnUpstreamStatuses) == 0 || slices.Contains(c.StaleOnUpstreamStatuses, strconv.Itoa(statusCode))
+}
+
+// IsEndpointEnabled reports whether the named OIDC endpoint should be served.
+// All endpoints are enabled when ENABLED_ENDPOINTS is empty.
+func (c *Config) IsEndpointEnabled(name string) bool {
+	return len(c.EnabledEndpoints) == 0 || slices.ContainsFunc(c.EnabledEndpoints, func(enabled string) bool {
+		return strings.EqualFold(enabled, name)
+	})
+}
+
+// GetWarmupBackoffInitial returns the delay before the first warm-up retry, at least one millisecond
+func (c *Config) GetWarmupBackoffInitial() time.Duration {
+	return time.Duration(max(c.WarmupBackoffInitialMS, 1)) * time.Millisecond
+}
+
+// GetWarmupBackoffMax returns the maximum delay between warm-up retries as a duration
+func (c *Config) GetWarmupBackoffMax() time.Duration {
+	return time.Duration(c.WarmupBackoffMaxMS) * time.Millisecond
+}
+
+// IsCacheOnly reports whether cache-only mode is requested, either directly or by
+// the presence of the cache-only marker file
+func (c *Config) IsCacheOnly() bool {
+	if c.CacheOnly {
+		return true
+	}
+	if c.CacheOnlyFile == "" {
+		return false
+	}
+	_, err := os.Stat(c.CacheOnlyFile)
+	return err == nil
+}
+
+// GetCACertPaths returns the CA bundle paths to trust, preferring the SA_CA_CERT_PATHS
+// list over the single SA_CA_CERT_PATH
+func (c *Config) GetCACertPaths() []string {
+	if len(c.SACACertPaths) > 0 {
+		return c.SACACertPaths
+	}
+	return []string{c.SACACertPath}
+}
+
+// GetDependencyHealthTimeout returns the dependency health probe timeout as a duration
+func (c *Config) GetDependencyHealthTimeout() time.Duration {
+	return time.Duration(c.DependencyHealthTimeoutSeconds) * time.Second
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -68,6 +367,18 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	valueStr := os.Getenv(key)
 	if valueStr == "" {
@@ -79,3 +390,25 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return value
 }
+
+// getEnvAsList returns the comma-separated values of key with whitespace trimmed and empty items dropped
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// getEnvAsOneOf returns the lowercased value if it is one of the allowed values, otherwise the default
+func getEnvAsOneOf(key, defaultValue string, allowed ...string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	for _, candidate := range allowed {
+		if value == candidate {
+			return value
+		}
+	}
+	return defaultValue
+}
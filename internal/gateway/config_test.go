@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -34,6 +35,83 @@ func TestLoadConfig(t *testing.T) {
 		if !config.PrettyPrintJSON {
 			t.Error("Expected PrettyPrintJSON to be true by default")
 		}
+		if config.ErrorLogDedupWindowSeconds != 0 {
+			t.Errorf("Expected ErrorLogDedupWindowSeconds 0, got %d", config.ErrorLogDedupWindowSeconds)
+		}
+		if config.FailMode != FailModeOpen {
+			t.Errorf("Expected FailMode open, got %s", config.FailMode)
+		}
+		if config.TLSSessionCacheSize != 64 {
+			t.Errorf("Expected TLSSessionCacheSize 64, got %d", config.TLSSessionCacheSize)
+		}
+		if config.ErrorFormat != ErrorFormatText {
+			t.Errorf("Expected ErrorFormat text, got %s", config.ErrorFormat)
+		}
+		if config.OptionsMode != OptionsModeReject {
+			t.Errorf("Expected OptionsMode reject, got %s", config.OptionsMode)
+		}
+		if config.MinJWKSKeys != 1 {
+			t.Errorf("Expected MinJWKSKeys 1, got %d", config.MinJWKSKeys)
+		}
+	})
+
+	t.Run("CA cert paths list overrides single path", func(t *testing.T) {
+		os.Clearenv()
+		if paths := LoadConfig().GetCACertPaths(); len(paths) != 1 || paths[0] != "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt" {
+			t.Errorf("Expected default CA path, got %v", paths)
+		}
+
+		os.Setenv("SA_CA_CERT_PATHS", " /a.crt, ,/b.crt ")
+		paths := LoadConfig().GetCACertPaths()
+		if len(paths) != 2 || paths[0] != "/a.crt" || paths[1] != "/b.crt" {
+			t.Errorf("Expected [/a.crt /b.crt], got %v", paths)
+		}
+	})
+
+	t.Run("Enabled endpoints default to all", func(t *testing.T) {
+		os.Clearenv()
+		config := LoadConfig()
+		if !config.IsEndpointEnabled(EndpointDiscovery) || !config.IsEndpointEnabled(EndpointJWKS) {
+			t.Error("Expected all endpoints to be enabled by default")
+		}
+
+		os.Setenv("ENABLED_ENDPOINTS", "JWKS")
+		config = LoadConfig()
+		if config.IsEndpointEnabled(EndpointDiscovery) {
+			t.Error("Expected discovery to be disabled")
+		}
+		if !config.IsEndpointEnabled(EndpointJWKS) {
+			t.Error("Expected jwks to be enabled")
+		}
+	})
+
+	t.Run("Log level is validated", func(t *testing.T) {
+		os.Clearenv()
+		if level := LoadConfig().LogLevel; level != "info" {
+			t.Errorf("Expected default log level info, got %q", level)
+		}
+
+		os.Setenv("LOG_LEVEL", "DEBUG")
+		if level := LoadConfig().LogLevel; level != "debug" {
+			t.Errorf("Expected log level debug, got %q", level)
+		}
+
+		os.Setenv("LOG_LEVEL", "verbose")
+		if level := LoadConfig().LogLevel; level != "info" {
+			t.Errorf("Expected unknown log level to fall back to info, got %q", level)
+		}
+	})
+
+	t.Run("Serving during warm-up is the default", func(t *testing.T) {
+		os.Clearenv()
+		if LoadConfig().RejectUntilWarm {
+			t.Error("Expected requests to be served during warm-up by default")
+		}
+
+		os.Setenv("SERVE_DURING_WARMUP", "false")
+		if !LoadConfig().RejectUntilWarm {
+			t.Error("Expected SERVE_DURING_WARMUP=false to reject requests until warm")
+		}
 	})
 
 	t.Run("Custom environment values", func(t *testing.T) {
@@ -45,6 +123,10 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("CACHE_TTL_SECONDS", "120")
 		os.Setenv("CLIENT_CACHE_TTL_SECONDS", "7200")
 		os.Setenv("PRETTY_PRINT_JSON", "false")
+		os.Setenv("ERROR_LOG_DEDUP_WINDOW_SECONDS", "30")
+		os.Setenv("FAIL_MODE", "CLOSED")
+		os.Setenv("UPSTREAM_QPS", "2.5")
+		os.Setenv("UPSTREAM_BURST", "4")
 
 		config := LoadConfig()
 
@@ -69,6 +151,18 @@ func TestLoadConfig(t *testing.T) {
 		if config.PrettyPrintJSON {
 			t.Error("Expected PrettyPrintJSON to be false")
 		}
+		if config.ErrorLogDedupWindowSeconds != 30 {
+			t.Errorf("Expected ErrorLogDedupWindowSeconds 30, got %d", config.ErrorLogDedupWindowSeconds)
+		}
+		if config.FailMode != FailModeClosed {
+			t.Errorf("Expected FailMode closed, got %s", config.FailMode)
+		}
+		if config.UpstreamQPS != 2.5 {
+			t.Errorf("Expected UpstreamQPS 2.5, got %v", config.UpstreamQPS)
+		}
+		if config.UpstreamBurst != 4 {
+			t.Errorf("Expected UpstreamBurst 4, got %d", config.UpstreamBurst)
+		}
 	})
 
 	t.Run("Duration conversions", func(t *testing.T) {
@@ -115,4 +209,31 @@ func TestLoadConfig(t *testing.T) {
 			t.Error("Expected default PrettyPrintJSON to be true")
 		}
 	})
+	t.Run("Invalid fail mode falls back to default", func(t *testing.T) {
+		os.Clearenv()
+		os.Setenv("FAIL_MODE", "sideways")
+
+		config := LoadConfig()
+
+		if config.FailMode != FailModeOpen {
+			t.Errorf("Expected default FailMode open, got %s", config.FailMode)
+		}
+	})
+	t.Run("Cache-only marker file enables cache-only mode", func(t *testing.T) {
+		os.Clearenv()
+		marker := filepath.Join(t.TempDir(), "cache-only")
+		os.Setenv("CACHE_ONLY_FILE", marker)
+
+		config := LoadConfig()
+		if config.IsCacheOnly() {
+			t.Error("Expected cache-only to be off while marker file is absent")
+		}
+
+		if err := os.WriteFile(marker, nil, 0o600); err != nil {
+			t.Fatalf("Failed to create marker file: %v", err)
+		}
+		if !config.IsCacheOnly() {
+			t.Error("Expected cache-only to be on while marker file exists")
+		}
+	})
 }
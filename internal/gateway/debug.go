@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwksDiff is the response body of the JWKS diff debug endpoint
+type jwksDiff struct {
+	CachedKeyIDs   []string `json:"cached_kids"`
+	UpstreamKeyIDs []string `json:"upstream_kids"`
+	Added          []string `json:"added"`
+	Removed        []string `json:"removed"`
+}
+
+// snapshotManifestEntry describes one cached body in a cache snapshot archive
+type snapshotManifestEntry struct {
+	Key       string    `json:"key"`
+	File      string    `json:"file"`
+	ETag      string    `json:"etag"`
+	Bytes     int       `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RequireDebugAuth wraps a debug handler so it is only reachable with the
+// configured debug bearer token
+func (a *App) RequireDebugAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.config.DebugAuthToken == "" || !ok ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(a.config.DebugAuthToken)) != 1 {
+			slog.Warn("debug_auth_failed", "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+			a.writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// HandleJWKSDiff handles the /debug/jwks/diff endpoint
+// Fetches the JWKS from upstream and compares its key IDs with the cached copy without modifying the cache
+func (a *App) HandleJWKSDiff(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	if a.upstreamClient == nil {
+		a.writeError(w, http.StatusServiceUnavailable, "upstream client not configured")
+		return
+	}
+
+	body, err := a.upstreamClient.Fetch(r.Context(), a.upstreamPath(jwksPath))
+	if err != nil {
+		slog.Warn("jwks_diff_error", "error", err)
+		a.writeError(w, http.StatusBadGateway, "Bad Gateway")
+		return
+	}
+
+	upstreamKeyIDs, err := jwksKeyIDs(body)
+	if err != nil {
+		slog.Warn("jwks_diff_error", "error", err)
+		a.writeError(w, http.StatusBadGateway, "Bad Gateway")
+		return
+	}
+
+	cachedKeyIDs := []string{}
+	if cached, _, found := a.cache.GetStale(a.cacheKey(jwksPath)); found {
+		if cachedKeyIDs, err = jwksKeyIDs(cached); err != nil {
+			slog.Warn("jwks_diff_error", "error", err)
+			a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+	}
+
+	diff := jwksDiff{
+		CachedKeyIDs:   cachedKeyIDs,
+		UpstreamKeyIDs: upstreamKeyIDs,
+	}
+	diff.Added, diff.Removed = diffKeyIDs(cachedKeyIDs, upstreamKeyIDs)
+
+	response, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleCacheSnapshot handles the /debug/cache/snapshot endpoint
+// Returns a zip archive holding every cached body, expired or not, and a manifest.json
+// recording each entry's ETag and expiry
+func (a *App) HandleCacheSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	entries := a.cache.Snapshot()
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	manifest := make([]snapshotManifestEntry, 0, len(keys))
+	for _, key := range keys {
+		entry := entries[key]
+		file := "bodies/" + strings.TrimPrefix(key, "/")
+		if err := writeZipFile(archive, file, entry.Body); err != nil {
+			slog.Error("cache_snapshot_error", "error", err)
+			a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		manifest = append(manifest, snapshotManifestEntry{
+			Key:       key,
+			File:      file,
+			ETag:      entry.ETag,
+			Bytes:     len(entry.Body),
+			CreatedAt: entry.CreatedAt.UTC(),
+			ExpiresAt: entry.ExpiresAt.UTC(),
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = writeZipFile(archive, "manifest.json", manifestJSON)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		slog.Error("cache_snapshot_error", "error", err)
+		a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.Info("cache_snapshot", "entries", len(manifest), "bytes", buf.Len(), "remote", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="cache-snapshot.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeZipFile adds a file with the given contents to a zip archive
+func writeZipFile(archive *zip.Writer, name string, contents []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	return err
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRequireDebugAuth(t *testing.T) {
+	app := &App{config: &Config{DebugAuthToken: "secret"}}
+	handler := app.RequireDebugAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"Valid token", "Bearer secret", http.StatusOK},
+		{"Wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"Missing token", "", http.StatusUnauthorized},
+		{"Wrong scheme", "Basic secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/jwks/diff", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+
+	t.Run("Empty configured token denies access", func(t *testing.T) {
+		app := &App{config: &Config{}}
+		handler := app.RequireDebugAuth(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/debug/jwks/diff", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", w.Code)
+		}
+	})
+}
+
+func TestHandleJWKSDiff(t *testing.T) {
+	t.Run("Reports added and removed key IDs without mutating the cache", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60}
+		app := &App{
+			config: config,
+			cache:  NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"keys":[{"kid":"key-2"},{"kid":"key-3"}]}`))
+			}),
+		}
+		cachedBody := []byte(`{"keys":[{"kid":"key-1"},{"kid":"key-2"}]}`)
+		app.cache.Set("/openid/v1/jwks", cachedBody, `"cached"`)
+
+		req := httptest.NewRequest("GET", "/debug/jwks/diff", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKSDiff(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		var diff jwksDiff
+		if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if !slices.Equal(diff.Added, []string{"key-3"}) {
+			t.Errorf("Expected added [key-3], got %v", diff.Added)
+		}
+		if !slices.Equal(diff.Removed, []string{"key-1"}) {
+			t.Errorf("Expected removed [key-1], got %v", diff.Removed)
+		}
+
+		body, etag, _ := app.cache.Get("/openid/v1/jwks")
+		if string(body) != string(cachedBody) || etag != `"cached"` {
+			t.Error("Expected cache to be unchanged")
+		}
+	})
+}
+
+func TestHandleCacheSnapshot(t *testing.T) {
+	app := &App{
+		config: &Config{},
+		cache:  NewCache(60 * time.Second),
+	}
+	captureLogs(t)
+	app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`)
+	app.cache.Set("/.well-known/openid-configuration", []byte(`{"issuer":"x"}`), `"d"`)
+
+	w := httptest.NewRecorder()
+	app.HandleCacheSnapshot(w, httptest.NewRequest("GET", "/debug/cache/snapshot", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Expected application/zip, got %q", ct)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		contents, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(contents)
+	}
+
+	if files["bodies/openid/v1/jwks"] != `{"keys":[]}` {
+		t.Errorf("Expected JWKS body in archive, got %q", files["bodies/openid/v1/jwks"])
+	}
+
+	var manifest []snapshotManifestEntry
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if len(manifest) != 2 {
+		t.Fatalf("Expected 2 manifest entries, got %d", len(manifest))
+	}
+	if manifest[1].Key != "/openid/v1/jwks" || manifest[1].ETag != `"j"` || manifest[1].ExpiresAt.IsZero() {
+		t.Errorf("Unexpected manifest entry %+v", manifest[1])
+	}
+}
@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache resolves upstream host names at most once per TTL and dials the cached addresses
+type dnsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	lookup  func(ctx context.Context, host string) ([]string, error)
+	dialer  *net.Dialer
+	entries map[string]dnsEntry
+}
+
+// dnsEntry holds the resolved addresses of a host until it expires; a pinned entry
+// has a zero expiry and never expires
+type dnsEntry struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+// newDNSCache creates a DNS cache with the given TTL using the default resolver
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		lookup:  net.DefaultResolver.LookupHost,
+		dialer:  &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// resolve returns the addresses of host, resolving it only when the cached entry has expired
+func (d *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	entry, found := d.entries[host]
+	d.mu.Unlock()
+	if found && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.entries[host] = dnsEntry{addrs: addrs, expiresAt: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// pin resolves host once and keeps its addresses for the lifetime of the cache
+func (d *dnsCache) pin(ctx context.Context, host string) ([]string, error) {
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	d.mu.Lock()
+	d.entries[host] = dnsEntry{addrs: addrs}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext dials addr using cached DNS results, trying each resolved address in turn
+func (d *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ip := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDNSCache(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	newCache := func(ttl time.Duration) (*dnsCache, *atomic.Int32) {
+		var lookups atomic.Int32
+		cache := newDNSCache(ttl)
+		cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+			lookups.Add(1)
+			return []string{"127.0.0.1"}, nil
+		}
+		return cache, &lookups
+	}
+
+	dial := func(t *testing.T, cache *dnsCache) {
+		t.Helper()
+		conn, err := cache.DialContext(context.Background(), "tcp", net.JoinHostPort("upstream.test", port))
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		conn.Close()
+	}
+
+	t.Run("Resolved addresses are reused within the TTL", func(t *testing.T) {
+		cache, lookups := newCache(time.Minute)
+
+		dial(t, cache)
+		dial(t, cache)
+
+		if lookups.Load() != 1 {
+			t.Errorf("Expected 1 lookup, got %d", lookups.Load())
+		}
+	})
+
+	t.Run("Host is resolved again after the TTL", func(t *testing.T) {
+		cache, lookups := newCache(10 * time.Millisecond)
+
+		dial(t, cache)
+		time.Sleep(20 * time.Millisecond)
+		dial(t, cache)
+
+		if lookups.Load() != 2 {
+			t.Errorf("Expected 2 lookups, got %d", lookups.Load())
+		}
+	})
+
+	t.Run("IP literals bypass resolution", func(t *testing.T) {
+		cache, lookups := newCache(time.Minute)
+
+		conn, err := cache.DialContext(context.Background(), "tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		conn.Close()
+
+		if lookups.Load() != 0 {
+			t.Errorf("Expected no lookups, got %d", lookups.Load())
+		}
+	})
+}
+
+func TestPinnedDial(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	var lookups atomic.Int32
+	cache := newDNSCache(0)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		if lookups.Add(1) > 1 {
+			return nil, errors.New("dns unavailable")
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	if _, err := cache.pin(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+
+	// The test server's certificate is issued for example.com, so success proves the
+	// TLS server name still comes from the URL rather than the pinned IP
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = cache.DialContext
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("https://" + net.JoinHostPort("example.com", port) + "/")
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+		resp.Body.Close()
+		transport.CloseIdleConnections()
+	}
+
+	if lookups.Load() != 1 {
+		t.Errorf("Expected a single lookup at pin time, got %d", lookups.Load())
+	}
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrUpstreamTimeout indicates the upstream request did not complete within its deadline
+	ErrUpstreamTimeout = errors.New("upstream request timed out")
+	// ErrUpstreamStatus indicates the API server answered with an unexpected status code
+	ErrUpstreamStatus = errors.New("upstream returned unexpected status")
+	// ErrUpstreamBody indicates the upstream response body could not be read
+	ErrUpstreamBody = errors.New("upstream response body unreadable")
+	// ErrUpstreamUnauthorized indicates the API server rejected the service account token (401 or 403)
+	ErrUpstreamUnauthorized = errors.New("upstream rejected service account token")
+	// ErrRequestBudgetExceeded indicates a request used up REQUEST_BUDGET_MS before upstream answered
+	ErrRequestBudgetExceeded = errors.New("request budget exceeded")
+)
+
+// StatusError reports an unexpected upstream status code. It matches ErrUpstreamStatus,
+// and also ErrUpstreamUnauthorized for 401 and 403, with errors.Is.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	if e.unauthorized() {
+		return fmt.Sprintf("%v: upstream returned status %d", ErrUpstreamUnauthorized, e.StatusCode)
+	}
+	return fmt.Sprintf("upstream returned status %d", e.StatusCode)
+}
+
+// Is reports whether target is one of the sentinel errors this status falls under
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUpstreamStatus:
+		return true
+	case ErrUpstreamUnauthorized:
+		return e.unauthorized()
+	}
+	return false
+}
+
+func (e *StatusError) unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// upstreamErrorKind classifies an upstream error for logging
+func upstreamErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrUpstreamUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrUpstreamStatus):
+		return "status"
+	case errors.Is(err, ErrUpstreamTimeout):
+		return "timeout"
+	case errors.Is(err, ErrUpstreamBody):
+		return "body"
+	}
+	return "transport"
+}
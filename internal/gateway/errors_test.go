@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		unauthorized bool
+	}{
+		{"Unauthorized", 401, true},
+		{"Forbidden", 403, true},
+		{"Not found", 404, false},
+		{"Server error", 500, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &StatusError{StatusCode: tt.statusCode})
+
+			if !errors.Is(err, ErrUpstreamStatus) {
+				t.Error("Expected error to match ErrUpstreamStatus")
+			}
+			if errors.Is(err, ErrUpstreamUnauthorized) != tt.unauthorized {
+				t.Errorf("Expected ErrUpstreamUnauthorized match %v", tt.unauthorized)
+			}
+			if errors.Is(err, ErrUpstreamTimeout) || errors.Is(err, ErrUpstreamBody) {
+				t.Error("Expected status error not to match timeout or body errors")
+			}
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.statusCode {
+				t.Errorf("Expected StatusError with code %d", tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorKind(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{&StatusError{StatusCode: 401}, "unauthorized"},
+		{&StatusError{StatusCode: 500}, "status"},
+		{fmt.Errorf("%w: deadline", ErrUpstreamTimeout), "timeout"},
+		{fmt.Errorf("%w: eof", ErrUpstreamBody), "body"},
+		{errors.New("connection refused"), "transport"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if kind := upstreamErrorKind(tt.err); kind != tt.expected {
+				t.Errorf("Expected kind %s, got %s", tt.expected, kind)
+			}
+		})
+	}
+}
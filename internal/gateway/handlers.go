@@ -2,58 +2,280 @@ package gateway
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
+const (
+	// discoveryPath is the OIDC discovery document path
+	discoveryPath = "/.well-known/openid-configuration"
+	// jwksPath is the JSON Web Key Set path
+	jwksPath = "/openid/v1/jwks"
+)
+
+// oidcPaths returns the paths of the OIDC endpoints enabled by configuration
+func (a *App) oidcPaths() []string {
+	var paths []string
+	if a.config.IsEndpointEnabled(EndpointDiscovery) {
+		paths = append(paths, discoveryPath)
+	}
+	if a.config.IsEndpointEnabled(EndpointJWKS) {
+		paths = append(paths, jwksPath)
+	}
+	return paths
+}
+
+// upstreamPath returns the upstream request path for an OIDC path, including any
+// configured static query string
+func (a *App) upstreamPath(path string) string {
+	query := ""
+	switch path {
+	case discoveryPath:
+		query = a.config.DiscoveryUpstreamQuery
+	case jwksPath:
+		query = a.config.JWKSUpstreamQuery
+	}
+	if query == "" {
+		return path
+	}
+	return path + "?" + query
+}
+
+// cacheKey returns the cache key for an OIDC path, which identifies the exact upstream
+// resource so that entries fetched with different queries never collide
+func (a *App) cacheKey(path string) string {
+	return a.upstreamPath(path)
+}
+
 // App holds the application state
 type App struct {
-	config         *Config
-	cache          *Cache
-	upstreamClient *UpstreamClient
+	config            *Config
+	cache             *Cache
+	upstreamClient    *UpstreamClient
+	errorLogs         *logDeduper
+	stats             requestStats
+	statsd            *statsdClient
+	metrics           *promMetrics
+	inFlight          atomic.Int64
+	requestLogs       atomic.Uint64
+	cacheOnly         atomic.Bool
+	warmedUp          atomic.Bool
+	upstreamFailures  atomic.Int64
+	discoveryFetched  atomic.Bool
+	reloadMu          sync.Mutex
+	populateMu        sync.Mutex
+	populating        *populateFlight
+	pairRefreshing    atomic.Bool
+	pairRefreshes     sync.WaitGroup
+	yaml              yamlCache
+	initErr           error
+	discoveryTemplate *template.Template
 }
 
 // NewApp creates a new application instance
 func NewApp(config *Config) (*App, error) {
+	for _, query := range []string{config.DiscoveryUpstreamQuery, config.JWKSUpstreamQuery} {
+		if _, err := url.ParseQuery(query); err != nil {
+			return nil, fmt.Errorf("invalid upstream query %q: %w", query, err)
+		}
+	}
+
+	for _, status := range config.StaleOnUpstreamStatuses {
+		if code, err := strconv.Atoi(status); err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid STALE_ON_UPSTREAM_STATUSES entry %q", status)
+		}
+	}
+
+	for _, name := range config.EnabledEndpoints {
+		if !strings.EqualFold(name, EndpointDiscovery) && !strings.EqualFold(name, EndpointJWKS) {
+			return nil, fmt.Errorf("invalid ENABLED_ENDPOINTS entry %q: must be %s or %s", name, EndpointDiscovery, EndpointJWKS)
+		}
+	}
+
+	for _, setting := range []struct{ name, value string }{
+		{"PUBLIC_ISSUER_URL", config.PublicIssuerURL},
+		{"PUBLIC_BASE_URL", config.PublicBaseURL},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(setting.value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid %s %q: must be an absolute URL", setting.name, setting.value)
+		}
+	}
+
+	if config.BootstrapDiscoveryJSON != "" {
+		if doc, err := decodeJSON([]byte(config.BootstrapDiscoveryJSON)); err != nil {
+			return nil, fmt.Errorf("invalid BOOTSTRAP_DISCOVERY_JSON: %w", err)
+		} else if _, ok := doc.(map[string]any); !ok {
+			return nil, fmt.Errorf("invalid BOOTSTRAP_DISCOVERY_JSON: not a JSON object")
+		}
+	}
+
+	var discoveryTemplate *template.Template
+	if config.DiscoveryTemplate != "" {
+		tmpl, err := parseDiscoveryTemplate(config.DiscoveryTemplate)
+		if err != nil {
+			return nil, err
+		}
+		discoveryTemplate = tmpl
+	}
+
 	upstreamClient, err := NewUpstreamClient(config)
-	if err != nil {
+	if err != nil && !config.DegradedStart {
 		return nil, err
 	}
 
 	cache := NewCache(config.GetCacheTTL())
 
-	return &App{
-		config:         config,
-		cache:          cache,
-		upstreamClient: upstreamClient,
-	}, nil
+	app := &App{
+		config:            config,
+		cache:             cache,
+		upstreamClient:    upstreamClient,
+		errorLogs:         newLogDeduper(config.GetErrorLogDedupWindow()),
+		discoveryTemplate: discoveryTemplate,
+	}
+
+	// In degraded start the server runs without an upstream so probes can report the failure
+	if err != nil {
+		slog.Warn("degraded_start", "reason", "upstream client initialization failed, readiness will fail", "error", err)
+		app.initErr = err
+	}
+
+	if config.StatsDAddr != "" {
+		if app.statsd, err = newStatsdClient(config.StatsDAddr, config.StatsDPrefix, config.GetStatsDFlushInterval() > 0); err != nil {
+			return nil, err
+		}
+		slog.Info("statsd_enabled", "addr", config.StatsDAddr, "prefix", config.StatsDPrefix, "flush_interval_ms", durationMillis(config.GetStatsDFlushInterval()))
+	}
+
+	if config.MetricsEnabled {
+		app.metrics = newPromMetrics(app.cacheAges)
+	}
+
+	app.SetCacheOnly(config.IsCacheOnly())
+
+	cache.SetMaxBytes(config.MaxCacheBytes)
+	if config.SlidingExpiration {
+		cache.SetSlidingExpiration(config.GetMaxAbsoluteAge())
+	}
+	if config.AuditKeyChanges {
+		cache.SetChangeHook(app.auditKeyChange)
+	}
+
+	if err := app.seedCache(); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// seedCache loads the configured seed files into the cache so the gateway can
+// serve immediately, before the first upstream fetch replaces them
+func (a *App) seedCache() error {
+	seeds := map[string]string{
+		discoveryPath: a.config.SeedDiscoveryFile,
+		jwksPath:      a.config.SeedJWKSFile,
+	}
+
+	for path, file := range seeds {
+		if file == "" {
+			continue
+		}
+
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read seed file for %s: %w", path, err)
+		}
+
+		if _, err := decodeJSON(body); err != nil {
+			return fmt.Errorf("invalid JSON in seed file %s: %w", file, err)
+		}
+
+		processedBody, err := a.processBody(path, body)
+		if err != nil {
+			return err
+		}
+
+		a.cache.Set(a.cacheKey(path), processedBody, computeETag(processedBody))
+		slog.Info("cache_seeded", "path", path, "file", file)
+	}
+
+	return nil
+}
+
+// Reload applies the runtime-reloadable subset of a freshly loaded configuration
+func (a *App) Reload(config *Config) {
+	// Serialize reloads so that overlapping ones apply in order
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	cacheOnly := config.IsCacheOnly()
+	slog.Info("config_reload", "cache_only", cacheOnly)
+	a.SetCacheOnly(cacheOnly)
+}
+
+// SetCacheOnly enables or disables cache-only mode, in which no upstream requests are made
+func (a *App) SetCacheOnly(enabled bool) {
+	previous := a.cacheOnly.Swap(enabled)
+	if enabled {
+		slog.Warn("cache_only_enabled", "reason", "upstream fetches are disabled and only cached data will be served")
+	} else if previous {
+		slog.Info("cache_only_disabled", "reason", "upstream fetches resumed")
+	}
 }
 
 // HandleOIDCDiscovery handles the /.well-known/openid-configuration endpoint
 func (a *App) HandleOIDCDiscovery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if !a.allowMethods(w, r, http.MethodGet) {
 		return
 	}
 
-	path := "/.well-known/openid-configuration"
-	a.handleCachedEndpoint(w, r, path)
+	a.handleCachedEndpoint(w, r, discoveryPath)
 }
 
 // HandleJWKS handles the /openid/v1/jwks endpoint
 func (a *App) HandleJWKS(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if !a.allowMethods(w, r, http.MethodGet) {
 		return
 	}
 
-	path := "/openid/v1/jwks"
-	a.handleCachedEndpoint(w, r, path)
+	a.handleCachedEndpoint(w, r, jwksPath)
+}
+
+// allowMethods enforces the methods an endpoint supports. OPTIONS is answered
+// with 204 and an Allow header, or rejected, according to the configured
+// OPTIONS mode; any other unsupported method gets 405. It reports whether the
+// handler should continue processing the request.
+func (a *App) allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if slices.Contains(methods, r.Method) {
+		return true
+	}
+
+	if a.config.OptionsMode == OptionsModeAllow {
+		methods = append(methods, http.MethodOptions)
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+
+	if r.Method == http.MethodOptions && a.config.OptionsMode == OptionsModeAllow {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	a.writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	return false
 }
 
 // handleCachedEndpoint is a common handler for cached endpoints
@@ -61,87 +283,497 @@ func (a *App) handleCachedEndpoint(w http.ResponseWriter, r *http.Request, path
 	start := time.Now()
 	var cacheHit bool
 	var statusCode int
+	var upstreamHost string
+
+	a.stats.requests.Add(1)
+	a.statsd.Increment("requests")
+	a.inFlight.Add(1)
+	defer a.inFlight.Add(-1)
 
 	defer func() {
+		a.metrics.observeRequest(path, statusCode)
 		duration := time.Since(start)
-		log.Printf("path=%s status=%d cache_hit=%v duration=%v", path, statusCode, cacheHit, duration)
+		attrs := func() []any {
+			attrs := []any{"path", path, "status", statusCode, "cache_hit", cacheHit, "duration_ms", durationMillis(duration)}
+			if upstreamHost != "" {
+				attrs = append(attrs, "upstream_host", upstreamHost)
+			}
+			return attrs
+		}
+
+		// With a slow-request threshold only outliers, at warning level, and errors are logged
+		if threshold := a.config.GetSlowRequestThreshold(); threshold > 0 {
+			if duration >= threshold {
+				slog.Warn("slow_request", append(attrs(), "threshold_ms", threshold.Milliseconds())...)
+			} else if statusCode >= http.StatusBadRequest {
+				slog.Info("request", attrs()...)
+			}
+			return
+		}
+
+		if statusCode >= http.StatusBadRequest || a.sampleRequestLog() {
+			slog.Info("request", attrs()...)
+		}
 	}()
 
-	// Check cache first
-	if cached, etag, found := a.cache.Get(path); found {
-		cacheHit = true
-		statusCode = http.StatusOK
-		a.writeJSONResponseWithETag(w, cached, etag, statusCode)
+	// Optionally refuse to serve until the cache has been populated once, for predictable cold starts
+	if a.config.RejectUntilWarm && !a.warmedUp.Load() {
+		statusCode = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(a.config.GetWarmupBackoffInitial().Seconds()), 1)))
+		a.writeError(w, statusCode, "Service Unavailable: cache warming up")
 		return
 	}
 
+	// Check cache first, unless the client asked for a fresh copy and bypassing is enabled
+	bypass := a.config.HonorClientNoCache && requestsNoCache(r)
+	if bypass {
+		slog.Info("cache_bypass", "path", path, "remote", r.RemoteAddr)
+	}
+	if !bypass {
+		// Only a hit extends a sliding expiration; a bypassing request never reads the entry
+		if entry, found := a.cache.Touch(a.cacheKey(path)); found {
+			a.stats.hits.Add(1)
+			a.statsd.Increment("cache.hit")
+			a.metrics.observeCache(path, true)
+			cacheHit = true
+			a.setCacheStatus(w, cacheStatusHit)
+			if a.config.DebugHeaders {
+				w.Header().Set("X-Cache-Expires", entry.ExpiresAt.UTC().Format(time.RFC3339))
+			}
+			statusCode = a.writeJSONResponse(w, r, path, entry, http.StatusOK)
+			return
+		}
+	}
+
 	// Cache miss - fetch from upstream
+	a.stats.misses.Add(1)
+	a.statsd.Increment("cache.miss")
+	a.metrics.observeCache(path, false)
 	cacheHit = false
+	a.setCacheStatus(w, cacheStatusMiss)
+
+	// In cache-only mode serve whatever is cached, however old, and never call upstream
+	if a.cacheOnly.Load() {
+		if staleEntry, found := a.cache.GetStaleEntry(a.cacheKey(path)); found {
+			a.stats.staleServed.Add(1)
+			a.statsd.Increment("stale_served")
+			a.metrics.observeStaleServed(path)
+			a.markStale(w)
+			statusCode = a.writeJSONResponse(w, r, path, staleEntry, http.StatusOK)
+			return
+		}
+
+		slog.Warn("cache_only_miss", "path", path)
+		statusCode = http.StatusServiceUnavailable
+		a.writeError(w, statusCode, "Service Unavailable")
+		return
+	}
+
+	// Without an upstream client (degraded start) only cached data can be served
+	if a.upstreamClient == nil {
+		statusCode = a.serveStaleOrFail(w, r, path)
+		return
+	}
+
+	// Bound the whole request, including retries and waits for upstream capacity, by the budget
+	ctx := a.upstreamContext(r)
+	if budget := a.config.GetRequestBudget(); budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, start.Add(budget), ErrRequestBudgetExceeded)
+		defer cancel()
+	}
+
+	upstreamHost = a.upstreamClient.Host()
 	upstreamStart := time.Now()
-	body, err := a.upstreamClient.Fetch(r.Context(), path)
+	resp, err := a.upstreamClient.FetchConditional(ctx, a.upstreamPath(path), a.revalidationETag(path))
 	upstreamDuration := time.Since(upstreamStart)
+	a.statsd.Timing("upstream.latency", upstreamDuration)
+	a.metrics.observeUpstreamLatency(path, upstreamDuration)
+
+	// Surface upstream latency on every response that involved an upstream call
+	if a.config.DebugHeaders {
+		w.Header().Set("X-Upstream-Duration-Ms", strconv.FormatInt(upstreamDuration.Milliseconds(), 10))
+	}
 
 	if err != nil {
-		log.Printf("upstream_error: path=%s error=%v duration=%v", path, err, upstreamDuration)
+		a.stats.upstreamErrors.Add(1)
+		a.statsd.Increment("upstream.error")
+		a.metrics.observeUpstreamError(path)
+
+		// Authentication failures need operator action rather than waiting out an outage
+		event, level := "upstream_error", slog.LevelWarn
+		if errors.Is(err, ErrUpstreamUnauthorized) {
+			event, level = "upstream_auth_rejected", slog.LevelError
+		}
+
+		// Escalate sustained outages so that alerting on log severity fires
+		failures := a.upstreamFailures.Add(1)
+		level = a.outageLevel(level, failures)
+
+		// Collapse identical errors during sustained outages; an escalation is always logged
+		if allowed, suppressed := a.errorLogs.Allow(level.String() + "|" + path + "|" + err.Error()); allowed {
+			attrs := []any{"path", path, "upstream_host", upstreamHost, "kind", upstreamErrorKind(err), "error", err, "duration_ms", durationMillis(upstreamDuration)}
+			if a.config.UpstreamErrorEscalationThreshold > 0 {
+				attrs = append(attrs, "consecutive_failures", failures)
+			}
+			if suppressed > 0 {
+				attrs = append(attrs, "repeated", suppressed)
+			}
+			slog.Log(r.Context(), level, event, attrs...)
+		}
 
-		// Try to serve stale cache on error (stale-on-error)
-		if staleData, staleETag, found := a.cache.GetStale(path); found {
-			log.Printf("serving_stale_cache: path=%s", path)
-			statusCode = http.StatusOK
-			a.writeJSONResponseWithETag(w, staleData, staleETag, statusCode)
+		// Once the budget is spent answer immediately: stale data if any, otherwise unavailable
+		if errors.Is(context.Cause(ctx), ErrRequestBudgetExceeded) {
+			slog.Warn("request_budget_exceeded", "path", path, "budget_ms", durationMillis(a.config.GetRequestBudget()))
+			if _, found := a.cache.GetStaleEntry(a.cacheKey(path)); !found && !a.bootstrapAvailable(path) {
+				statusCode = http.StatusServiceUnavailable
+				a.writeError(w, statusCode, "Service Unavailable")
+				return
+			}
+			statusCode = a.serveStaleOrFail(w, r, path)
 			return
 		}
 
-		statusCode = http.StatusBadGateway
-		http.Error(w, "Bad Gateway", statusCode)
+		// Statuses excluded from stale-on-error are surfaced rather than masked by old data
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !a.config.ServesStaleOnStatus(statusErr.StatusCode) {
+			if a.bootstrapAvailable(path) {
+				statusCode = a.writeBootstrapDiscovery(w, path)
+				return
+			}
+			statusCode = a.writeUpstreamFailure(w)
+			return
+		}
+
+		statusCode = a.serveStaleOrFail(w, r, path)
 		return
 	}
 
-	// Process the response
-	var processedBody []byte
-	if a.config.PrettyPrintJSON {
-		// Parse and pretty-print JSON
-		var jsonData any
-		if err := json.Unmarshal(body, &jsonData); err != nil {
-			log.Printf("json_parse_error: path=%s error=%v", path, err)
-			statusCode = http.StatusBadGateway
-			http.Error(w, "Bad Gateway", statusCode)
-			return
-		}
+	a.resetUpstreamFailures()
 
-		prettyJSON, err := json.MarshalIndent(jsonData, "", "  ")
-		if err != nil {
-			log.Printf("json_marshal_error: path=%s error=%v", path, err)
-			statusCode = http.StatusInternalServerError
-			http.Error(w, "Internal Server Error", statusCode)
+	// An unchanged document only needs its freshness renewed
+	if resp.NotModified {
+		if entry, renewed := a.cache.Renew(a.cacheKey(path), a.freshnessOrigin(resp)); renewed {
+			statusCode = a.writeJSONResponse(w, r, path, entry, http.StatusOK)
+			slog.Info("upstream_not_modified", "path", path, "upstream_host", upstreamHost, "duration_ms", durationMillis(upstreamDuration))
 			return
 		}
-		processedBody = prettyJSON
-	} else {
-		processedBody = body
+		a.stats.upstreamErrors.Add(1)
+		a.statsd.Increment("upstream.error")
+		a.metrics.observeUpstreamError(path)
+		slog.Warn("upstream_not_modified_uncached", "path", path, "upstream_host", upstreamHost)
+		statusCode = a.serveStaleOrFail(w, r, path)
+		return
+	}
+
+	// Process and validate the response, treating an invalid document like an upstream failure
+	processedBody, err := a.processBody(path, resp.Body)
+	if err != nil {
+		a.stats.upstreamErrors.Add(1)
+		a.statsd.Increment("upstream.error")
+		a.metrics.observeUpstreamError(path)
+		slog.Warn("upstream_document_invalid", "path", path, "upstream_host", upstreamHost, "error", err)
+		statusCode = a.serveStaleOrFail(w, r, path)
+		return
 	}
 
 	// Generate ETag for the content
-	hash := sha256.Sum256(processedBody)
-	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	etag := computeETag(processedBody)
 
 	// Store in cache with ETag
-	a.cache.Set(path, processedBody, etag)
+	entry := a.cache.SetAt(a.cacheKey(path), processedBody, etag, a.freshnessOrigin(resp), resp.Header.Get("ETag"))
+	if path == discoveryPath {
+		a.discoveryFetched.Store(true)
+	}
 
+	// Keep discovery and JWKS from drifting apart by refreshing them together
 	// Return response
-	statusCode = http.StatusOK
-	a.writeJSONResponseWithETag(w, processedBody, etag, statusCode)
+	statusCode = a.writeJSONResponse(w, r, path, entry, http.StatusOK)
+
+	// Keep discovery and JWKS from drifting apart by refreshing them together
+	if a.config.AtomicOIDCRefresh {
+		a.refreshSkewedPair(ctx, path, entry)
+	}
+
+	slog.Debug("upstream_fetch", "path", path, "upstream_host", upstreamHost, "duration_ms", durationMillis(upstreamDuration))
+}
+
+// refreshSkewedPair refreshes the sibling OIDC document when the entry just stored for
+// path is further apart in time than the configured skew from it. Only the sibling is
+// fetched, since path itself is already current. The fetch runs in the background after
+// the response has been written, keeping the request's audit ID and bounded by the
+// request budget; at most one such refresh runs at a time.
+func (a *App) refreshSkewedPair(ctx context.Context, path string, entry CacheEntry) {
+	sibling := discoveryPath
+	if path == discoveryPath {
+		sibling = jwksPath
+	}
+
+	siblingEntry, found := a.cache.GetStaleEntry(a.cacheKey(sibling))
+	if !found {
+		return
+	}
+
+	skew := entry.CreatedAt.Sub(siblingEntry.CreatedAt)
+	if skew <= a.config.GetOIDCRefreshSkew() {
+		return
+	}
+
+	if !a.pairRefreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	slog.Info("oidc_pair_refresh", "path", path, "sibling", sibling, "skew_ms", durationMillis(skew))
+
+	// The refresh outlives the request, so it must not be cancelled along with it
+	refreshCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+	if budget := a.config.GetRequestBudget(); budget > 0 {
+		refreshCtx, cancel = context.WithTimeoutCause(refreshCtx, budget, ErrRequestBudgetExceeded)
+	}
+	a.pairRefreshes.Go(func() {
+		defer a.pairRefreshing.Store(false)
+		defer cancel()
+
+		if err := a.refreshPath(refreshCtx, sibling, true); err != nil {
+			slog.Warn("oidc_pair_refresh_failed", "path", sibling, "error", err)
+		}
+	})
+}
+
+// outageLevel returns the log level for an upstream error after the given number of
+// consecutive failures: level itself, raised to error once the escalation threshold is
+// reached when one is configured
+func (a *App) outageLevel(level slog.Level, failures int64) slog.Level {
+	if threshold := a.config.UpstreamErrorEscalationThreshold; threshold > 0 && failures >= int64(threshold) {
+		return slog.LevelError
+	}
+	return level
+}
+
+// resetUpstreamFailures clears the consecutive upstream failure count after a successful
+// fetch, logging the recovery if the outage had escalated
+func (a *App) resetUpstreamFailures() {
+	failures := a.upstreamFailures.Swap(0)
+	if threshold := a.config.UpstreamErrorEscalationThreshold; threshold > 0 && failures >= int64(threshold) {
+		slog.Info("upstream_recovered", "consecutive_failures", failures)
+	}
+}
+
+// revalidationETag returns the upstream ETag to send as If-None-Match when refreshing
+// path, or an empty string when conditional requests are disabled or none is known
+func (a *App) revalidationETag(path string) string {
+	if !a.config.ConditionalUpstreamRequests {
+		return ""
+	}
+	entry, found := a.cache.GetStaleEntry(a.cacheKey(path))
+	if !found {
+		return ""
+	}
+	return entry.UpstreamETag
+}
+
+// freshnessOrigin returns the time a fetched document's cache freshness is measured
+// from: the upstream origin time when enabled, otherwise the local receive time
+func (a *App) freshnessOrigin(resp *UpstreamResponse) time.Time {
+	if a.config.UpstreamDateFreshness {
+		return resp.OriginTime()
+	}
+	return resp.ReceivedAt
+}
+
+// sampleRequestLog reports whether a successful request should be logged, keeping
+// one in every LOG_SAMPLE_RATE requests
+func (a *App) sampleRequestLog() bool {
+	rate := uint64(max(a.config.LogSampleRate, 1))
+	return a.requestLogs.Add(1)%rate == 1%rate
+}
+
+// serveStaleOrFail serves the stale cache entry for path if one exists (stale-on-error),
+// otherwise writes an error according to the fail mode. It returns the status code written.
+func (a *App) serveStaleOrFail(w http.ResponseWriter, r *http.Request, path string) int {
+	if staleEntry, found := a.cache.GetStaleEntry(a.cacheKey(path)); found {
+		a.stats.staleServed.Add(1)
+		a.statsd.Increment("stale_served")
+		a.metrics.observeStaleServed(path)
+		slog.Warn("serving_stale_cache", "path", path)
+		a.markStale(w)
+		return a.writeJSONResponse(w, r, path, staleEntry, http.StatusOK)
+	}
+
+	if a.bootstrapAvailable(path) {
+		return a.writeBootstrapDiscovery(w, path)
+	}
+
+	return a.writeUpstreamFailure(w)
+}
+
+// bootstrapAvailable reports whether the bootstrap discovery document stands in for path,
+// which is only the case until the API server has served a real discovery document
+func (a *App) bootstrapAvailable(path string) bool {
+	return path == discoveryPath && a.config.BootstrapDiscoveryJSON != "" && !a.discoveryFetched.Load()
+}
+
+// writeBootstrapDiscovery serves the configured bootstrap discovery document. It is marked
+// uncacheable so that clients pick up the real document as soon as the gateway has it.
+func (a *App) writeBootstrapDiscovery(w http.ResponseWriter, path string) int {
+	if allowed, suppressed := a.errorLogs.Allow("bootstrap_discovery|" + path); allowed {
+		attrs := []any{"path", path, "reason", "upstream has never served discovery"}
+		if suppressed > 0 {
+			attrs = append(attrs, "repeated", suppressed)
+		}
+		slog.Warn("serving_bootstrap_discovery", attrs...)
+	}
+
+	body := []byte(a.config.BootstrapDiscoveryJSON)
+	w.Header().Set("Content-Type", a.contentType(path))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	return http.StatusOK
+}
+
+const (
+	// cacheStatusHit marks a response served from a fresh cache entry
+	cacheStatusHit = "HIT"
+	// cacheStatusMiss marks a response that required an upstream fetch
+	cacheStatusMiss = "MISS"
+	// cacheStatusStale marks a response served from an expired cache entry
+	cacheStatusStale = "STALE"
+)
+
+// setCacheStatus reports the cache decision in the X-Cache header when enabled
+func (a *App) setCacheStatus(w http.ResponseWriter, status string) {
+	if a.config.CacheStatusHeader {
+		w.Header().Set("X-Cache", status)
+	}
+}
+
+// staleWarning is the RFC 7234 warning for a response served after its freshness expired
+const staleWarning = `110 - "Response is Stale"`
+
+// markStale flags a response served from an expired cache entry in the enabled headers
+func (a *App) markStale(w http.ResponseWriter) {
+	a.setCacheStatus(w, cacheStatusStale)
+	if a.config.StaleWarningHeader {
+		w.Header().Add("Warning", staleWarning)
+	}
+}
+
+// writeUpstreamFailure writes the error response for an upstream failure that cannot be
+// served from cache and returns the status code
+func (a *App) writeUpstreamFailure(w http.ResponseWriter) int {
+	// Nothing cached to fall back on; the fail mode decides how clients see the outage
+	if a.config.FailMode == FailModeClosed {
+		a.writeError(w, http.StatusServiceUnavailable, "Service Unavailable")
+		return http.StatusServiceUnavailable
+	}
 
-	log.Printf("upstream_fetch: path=%s duration=%v", path, upstreamDuration)
+	a.writeError(w, http.StatusBadGateway, "Bad Gateway")
+	return http.StatusBadGateway
 }
 
-// writeJSONResponseWithETag writes JSON response with cache headers and ETag
-func (a *App) writeJSONResponseWithETag(w http.ResponseWriter, body []byte, etag string, statusCode int) {
-	expires := time.Now().UTC().Add(a.config.GetClientCacheTTL())
-	w.Header().Set("Content-Type", "application/json")
+// requestsNoCache reports whether the request carries a Cache-Control: no-cache directive
+func requestsNoCache(r *http.Request) bool {
+	for _, value := range r.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeJSONResponse writes a cached JSON entry with cache headers, ETag, Age and an
+// explicit Content-Length, which HTTP/1.0 clients need because they cannot use chunking.
+// A request whose If-None-Match matches gets 304 without a body. It returns the status code written.
+func (a *App) writeJSONResponse(w http.ResponseWriter, r *http.Request, path string, entry CacheEntry, statusCode int) int {
+	now := time.Now()
+	// Expires is an absolute time, so pull it in by the skew buffer for clients whose clocks
+	// run ahead; max-age is relative and takes precedence for HTTP/1.1 clients anyway
+	expires := now.UTC().Add(max(a.config.GetClientCacheTTL()-a.config.GetExpiresSkew(), 0))
+	age := max(int(now.Sub(entry.CreatedAt).Seconds()), 0)
+
+	// The cache always holds JSON; a YAML representation is derived on request
+	body, contentType, etag := entry.Body, a.contentType(path), entry.ETag
+	if a.config.DiscoveryYAMLEnabled && path == discoveryPath {
+		w.Header().Add("Vary", "Accept")
+	}
+	if a.wantsYAML(r, path) {
+		if yamlBody, err := a.yaml.get(entry); err == nil {
+			body, contentType, etag = yamlBody, yamlContentType, yamlETag(entry.ETag)
+		} else {
+			slog.Warn("yaml_conversion_failed", "path", path, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", a.config.ClientCacheTTLSeconds))
 	w.Header().Set("Expires", expires.Format(http.TimeFormat))
 	w.Header().Set("ETag", etag)
+	w.Header().Set("Age", strconv.Itoa(age))
+	removeHopByHopHeaders(w.Header())
+	if closesConnection(r) {
+		w.Header().Set("Connection", "close")
+	}
+
+	// A client already holding this version only needs the validators and freshness headers
+	if statusCode == http.StatusOK && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	w.Write(body)
+	return statusCode
+}
+
+// contentType returns the configured response content type for an OIDC path
+func (a *App) contentType(path string) string {
+	contentType := ""
+	switch path {
+	case discoveryPath:
+		contentType = a.config.DiscoveryContentType
+	case jwksPath:
+		contentType = a.config.JWKSContentType
+	}
+	if contentType == "" {
+		return "application/json"
+	}
+	return contentType
+}
+
+// problemDetails is an RFC 7807 problem details error response
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeError writes an error response in the configured error format
+func (a *App) writeError(w http.ResponseWriter, statusCode int, message string) {
+	if a.config.ErrorFormat != ErrorFormatProblem {
+		http.Error(w, message, statusCode)
+		return
+	}
+
+	body, err := json.Marshal(problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: message,
+	})
+	if err != nil {
+		http.Error(w, message, statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(statusCode)
 	w.Write(body)
 }
@@ -149,83 +781,215 @@ func (a *App) writeJSONResponseWithETag(w http.ResponseWriter, body []byte, etag
 // HandleHealthz handles the /healthz endpoint
 // Liveness probe - fetches and caches both OIDC endpoints
 func (a *App) HandleHealthz(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if !a.allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	// A degraded start keeps the process alive so readiness can report why
+	if a.initErr != nil {
+		a.writeHealthResponse(w, r, http.StatusOK, "OK")
 		return
 	}
 
 	if err := a.populateCache(); err != nil {
-		log.Printf("health check failed: %v", err)
-		http.Error(w, "Service Unhealthy", http.StatusServiceUnavailable)
+		slog.Warn("health_check_failed", "error", err)
+		a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unhealthy")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	a.writeHealthResponse(w, r, http.StatusOK, "OK")
 }
 
 // HandleReadyz handles the /readyz endpoint
 // Readiness probe - fetches and caches both OIDC endpoints
 func (a *App) HandleReadyz(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if !a.allowMethods(w, r, http.MethodGet, http.MethodHead) {
 		return
 	}
 
+	if a.initErr != nil {
+		slog.Warn("readiness_check_failed", "state", "degraded_start", "error", a.initErr)
+		a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unavailable: degraded start: "+a.initErr.Error())
+		return
+	}
+
+	// A gateway that never warmed up needs different triage from one whose refreshes started failing
 	if err := a.populateCache(); err != nil {
-		log.Printf("readiness check failed: %v", err)
-		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		state, reason := "degraded", "degraded: cache was populated but refreshing it failed"
+		if !a.warmedUp.Load() {
+			state, reason = "cold", "cold start: cache has never been populated"
+		}
+		slog.Warn("readiness_check_failed", "state", state, "error", err)
+		a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unavailable: "+reason)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	if a.config.CheckJWKSConsistency && a.config.IsEndpointEnabled(EndpointDiscovery) {
+		discovery, _, found := a.cache.GetStale(a.cacheKey(discoveryPath))
+		if !found {
+			slog.Warn("readiness_check_failed", "reason", "discovery document not cached")
+			a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+		if err := checkJWKSConsistency(discovery); err != nil {
+			slog.Warn("readiness_check_failed", "reason", "jwks consistency", "error", err)
+			a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+	}
+
+	if a.config.DependencyHealthURL != "" {
+		if err := a.checkDependency(r.Context()); err != nil {
+			slog.Warn("readiness_check_failed", "reason", "dependency", "error", err)
+			a.writeHealthResponse(w, r, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+	}
+
+	a.writeHealthResponse(w, r, http.StatusOK, "OK")
+}
+
+// writeHealthResponse writes a plain text health response, omitting the body for HEAD requests
+func (a *App) writeHealthResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	if statusCode != http.StatusOK {
+		a.writeError(w, statusCode, message)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+	w.Write([]byte(message))
+}
+
+// checkDependency probes the configured dependency health URL, expecting a 2xx response
+func (a *App) checkDependency(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, a.config.GetDependencyHealthTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.DependencyHealthURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
 // HandleNotFound handles all other paths
 func (a *App) HandleNotFound(w http.ResponseWriter, r *http.Request) {
-	log.Printf("path=%s status=404 method=%s", r.URL.Path, r.Method)
-	http.Error(w, "Not Found", http.StatusNotFound)
+	slog.Info("request", "path", r.URL.Path, "status", http.StatusNotFound, "method", r.Method)
+	a.writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// populateFlight is a cache population in progress, whose result is shared by every
+// caller that asked for one while it ran
+type populateFlight struct {
+	done chan struct{}
+	err  error
 }
 
-// populateCache fetches and caches both OIDC endpoints
+// populateCache fetches and caches both OIDC endpoints. Probes, warm-up and the
+// integrity checker can all trigger it; concurrent calls share a single population
+// instead of each fetching from upstream.
 func (a *App) populateCache() error {
-	if a.upstreamClient == nil {
-		return fmt.Errorf("upstream client not configured")
+	a.populateMu.Lock()
+	if flight := a.populating; flight != nil {
+		a.populateMu.Unlock()
+		<-flight.done
+		return flight.err
 	}
+	flight := &populateFlight{done: make(chan struct{})}
+	a.populating = flight
+	a.populateMu.Unlock()
+
+	flight.err = a.fillCache()
+
+	a.populateMu.Lock()
+	a.populating = nil
+	a.populateMu.Unlock()
+	close(flight.done)
 
-	paths := []string{
-		"/.well-known/openid-configuration",
-		"/openid/v1/jwks",
+	return flight.err
+}
+
+// fillCache fetches and caches both OIDC endpoints; callers go through populateCache
+func (a *App) fillCache() error {
+	paths := a.oidcPaths()
+
+	// In cache-only mode health depends on having something cached rather than on upstream
+	if a.cacheOnly.Load() {
+		for _, path := range paths {
+			if _, _, found := a.cache.GetStale(a.cacheKey(path)); !found {
+				return fmt.Errorf("cache-only mode active and %s is not cached", path)
+			}
+		}
+		a.warmedUp.Store(true)
+		return nil
+	}
+
+	if a.upstreamClient == nil {
+		return fmt.Errorf("upstream client not configured")
 	}
 
 	for _, path := range paths {
-		body, err := a.upstreamClient.Fetch(context.Background(), path)
-		if err != nil {
+		if err := a.refreshPath(context.Background(), path, true); err != nil {
 			return err
 		}
+	}
 
-		// Apply pretty-print processing if enabled
-		processedBody := body
-		if a.config.PrettyPrintJSON {
-			var jsonData any
-			if err := json.Unmarshal(body, &jsonData); err != nil {
-				return fmt.Errorf("failed to parse JSON for %s: %w", path, err)
-			}
+	a.warmedUp.Store(true)
+	return nil
+}
 
-			prettyJSON, err := json.MarshalIndent(jsonData, "", "  ")
-			if err != nil {
-				return fmt.Errorf("failed to format JSON for %s: %w", path, err)
-			}
-			processedBody = prettyJSON
-		}
+// refreshPath fetches a single OIDC document from upstream and caches it. With revalidate,
+// the known upstream ETag is sent so that an unchanged document only has its freshness
+// renewed; without it the document is always downloaded again.
+func (a *App) refreshPath(ctx context.Context, path string, revalidate bool) error {
+	if a.upstreamClient == nil {
+		return fmt.Errorf("upstream client not configured")
+	}
 
-		// Generate ETag
-		hash := sha256.Sum256(processedBody)
-		etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	etag := ""
+	if revalidate {
+		etag = a.revalidationETag(path)
+	}
+	resp, err := a.upstreamClient.FetchConditional(ctx, a.upstreamPath(path), etag)
+	if err != nil {
+		// Probes and background refreshes count towards an outage like client requests do
+		a.upstreamFailures.Add(1)
+		return err
+	}
+	a.resetUpstreamFailures()
 
-		a.cache.Set(path, processedBody, etag)
+	if resp.NotModified {
+		if _, renewed := a.cache.Renew(a.cacheKey(path), a.freshnessOrigin(resp)); !renewed {
+			return fmt.Errorf("upstream reported %s not modified but it is no longer cached", path)
+		}
+		return nil
 	}
 
+	// Apply pretty-print processing if enabled
+	processedBody, err := a.processBody(path, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	a.cache.SetAt(a.cacheKey(path), processedBody, computeETag(processedBody), a.freshnessOrigin(resp), resp.Header.Get("ETag"))
+	if path == discoveryPath {
+		a.discoveryFetched.Store(true)
+	}
 	return nil
 }
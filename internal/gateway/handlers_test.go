@@ -1,11 +1,57 @@
 package gateway
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// captureLogs redirects the standard logger to a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// newTestUpstreamClient creates an upstream client backed by a test server running the given handler
+func newTestUpstreamClient(t *testing.T, handler http.HandlerFunc) *UpstreamClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &UpstreamClient{
+		httpClient: server.Client(),
+		baseURL:    server.URL,
+		token:      "test-token",
+	}
+}
+
+// oidcUpstreamHandler serves minimal discovery and JWKS documents
+func oidcUpstreamHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		w.Write([]byte(`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks"}`))
+	case "/openid/v1/jwks":
+		w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"key-1","n":"AQAB","e":"AQAB"}]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 func TestHandlers(t *testing.T) {
 	// Create a test app with mock upstream
 	config := &Config{
@@ -42,6 +88,20 @@ func TestHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("HandleHealthz accepts HEAD without body", func(t *testing.T) {
+		req := httptest.NewRequest("HEAD", "/healthz", nil)
+		w := httptest.NewRecorder()
+
+		app.HandleHealthz(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 without upstream, got %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("Expected empty body for HEAD, got %q", w.Body.String())
+		}
+	})
+
 	t.Run("HandleReadyz returns 503 when upstream unavailable", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/readyz", nil)
 		w := httptest.NewRecorder()
@@ -54,6 +114,46 @@ func TestHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("HandleReadyz accepts HEAD without body", func(t *testing.T) {
+		req := httptest.NewRequest("HEAD", "/readyz", nil)
+		w := httptest.NewRecorder()
+
+		app.HandleReadyz(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("Expected empty body for HEAD, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("HEAD health endpoints return 200 with healthy upstream", func(t *testing.T) {
+		healthyApp := &App{
+			config:         config,
+			cache:          NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+
+		handlers := map[string]func(http.ResponseWriter, *http.Request){
+			"/healthz": healthyApp.HandleHealthz,
+			"/readyz":  healthyApp.HandleReadyz,
+		}
+		for path, handler := range handlers {
+			req := httptest.NewRequest("HEAD", path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected status 200, got %d", path, w.Code)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: expected empty body for HEAD, got %q", path, w.Body.String())
+			}
+		}
+	})
+
 	t.Run("HandleNotFound returns 404", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/unknown-path", nil)
 		w := httptest.NewRecorder()
@@ -224,4 +324,1577 @@ func TestCacheIntegration(t *testing.T) {
 			t.Error("Expected Expires header to be set")
 		}
 	})
+	t.Run("Cached endpoint updates request stats", func(t *testing.T) {
+		config := &Config{
+			CacheTTLSeconds:       60,
+			ClientCacheTTLSeconds: 3600,
+			PrettyPrintJSON:       false,
+		}
+
+		app := &App{
+			config:         config,
+			cache:          NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+			w := httptest.NewRecorder()
+			app.HandleJWKS(w, req)
+		}
+
+		s := app.stats.snapshot()
+		if s.Requests != 3 || s.Hits != 2 || s.Misses != 1 {
+			t.Errorf("Expected 3 requests, 2 hits, 1 miss, got %+v", s)
+		}
+	})
+}
+
+func TestFailMode(t *testing.T) {
+	failingUpstream := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		failMode       string
+		expectedStatus int
+	}{
+		{FailModeOpen, http.StatusBadGateway},
+		{FailModeClosed, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.failMode+" mode with empty cache and failing upstream", func(t *testing.T) {
+			config := &Config{
+				CacheTTLSeconds:       60,
+				ClientCacheTTLSeconds: 3600,
+				FailMode:              tt.failMode,
+			}
+
+			app := &App{
+				config:         config,
+				cache:          NewCache(config.GetCacheTTL()),
+				upstreamClient: newTestUpstreamClient(t, failingUpstream),
+			}
+
+			req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+			w := httptest.NewRecorder()
+
+			app.HandleJWKS(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestStaleOnUpstreamStatuses(t *testing.T) {
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}
+
+	tests := []struct {
+		name           string
+		statuses       []string
+		expectedStatus int
+	}{
+		{"Default serves stale on 404", nil, http.StatusOK},
+		{"Listed status serves stale", []string{"404", "503"}, http.StatusOK},
+		{"Unlisted status fails", []string{"503"}, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{
+				config:         &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, StaleOnUpstreamStatuses: tt.statuses},
+				cache:          NewCache(60 * time.Second),
+				upstreamClient: newTestUpstreamClient(t, notFound),
+			}
+			app.cache.Set("/.well-known/openid-configuration", []byte(`{"issuer":"x"}`), `"d"`)
+			app.cache.entries["/.well-known/openid-configuration"].ExpiresAt = time.Now().Add(-time.Second)
+			captureLogs(t)
+
+			w := httptest.NewRecorder()
+			app.HandleOIDCDiscovery(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && w.Body.String() != `{"issuer":"x"}` {
+				t.Errorf("Expected stale body, got %s", w.Body.String())
+			}
+		})
+	}
+
+	t.Run("Invalid status is rejected", func(t *testing.T) {
+		if _, err := NewApp(&Config{StaleOnUpstreamStatuses: []string{"not-found"}}); err == nil {
+			t.Error("Expected NewApp to reject the status list")
+		}
+	})
+}
+
+func TestCacheOnlyMode(t *testing.T) {
+	newCacheOnlyApp := func(t *testing.T, upstreamCalls *int) *App {
+		config := &Config{
+			CacheTTLSeconds:       60,
+			ClientCacheTTLSeconds: 3600,
+		}
+		app := &App{
+			config: config,
+			cache:  NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				*upstreamCalls++
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		app.SetCacheOnly(true)
+		return app
+	}
+
+	t.Run("Returns 503 without calling upstream when nothing cached", func(t *testing.T) {
+		upstreamCalls := 0
+		app := newCacheOnlyApp(t, &upstreamCalls)
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+		if upstreamCalls != 0 {
+			t.Errorf("Expected no upstream calls, got %d", upstreamCalls)
+		}
+	})
+
+	t.Run("Serves expired entries without calling upstream", func(t *testing.T) {
+		upstreamCalls := 0
+		app := newCacheOnlyApp(t, &upstreamCalls)
+		app.cache = NewCache(-time.Second)
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"stale"`)
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if w.Body.String() != `{"keys":[]}` {
+			t.Errorf("Expected cached body, got %s", w.Body.String())
+		}
+		if upstreamCalls != 0 {
+			t.Errorf("Expected no upstream calls, got %d", upstreamCalls)
+		}
+	})
+
+	t.Run("Reload toggles cache-only mode off", func(t *testing.T) {
+		upstreamCalls := 0
+		app := newCacheOnlyApp(t, &upstreamCalls)
+
+		app.Reload(&Config{CacheOnly: false})
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if upstreamCalls != 1 {
+			t.Errorf("Expected 1 upstream call, got %d", upstreamCalls)
+		}
+	})
+}
+
+func TestReadyzJWKSConsistency(t *testing.T) {
+	t.Run("Consistent jwks_uri keeps readiness up", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, CheckJWKSConsistency: true}
+		app := &App{
+			config:         config,
+			cache:          NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+		app.HandleReadyz(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("Mismatched jwks_uri fails readiness", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, CheckJWKSConsistency: true}
+		app := &App{
+			config: config,
+			cache:  NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == discoveryPath {
+					w.Write([]byte(`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/keys"}`))
+					return
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+		app.HandleReadyz(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+	})
+}
+
+func TestErrorFormat(t *testing.T) {
+	t.Run("Text format by default", func(t *testing.T) {
+		app := &App{config: &Config{}}
+
+		req := httptest.NewRequest("GET", "/unknown-path", nil)
+		w := httptest.NewRecorder()
+		app.HandleNotFound(w, req)
+
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("Expected text/plain content type, got %s", ct)
+		}
+		if w.Body.String() != "Not Found\n" {
+			t.Errorf("Expected plain text body, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Problem format writes RFC 7807 body", func(t *testing.T) {
+		app := &App{config: &Config{ErrorFormat: ErrorFormatProblem}}
+
+		req := httptest.NewRequest("POST", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405, got %d", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("Expected application/problem+json, got %s", ct)
+		}
+
+		var problem problemDetails
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Expected JSON body, got %q: %v", w.Body.String(), err)
+		}
+		if problem.Type != "about:blank" || problem.Title != "Method Not Allowed" || problem.Status != http.StatusMethodNotAllowed {
+			t.Errorf("Unexpected problem details %+v", problem)
+		}
+	})
+
+	t.Run("Problem format applies to upstream failures", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, ErrorFormat: ErrorFormatProblem}
+		app := &App{
+			config: config,
+			cache:  NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "upstream down", http.StatusInternalServerError)
+			}),
+		}
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		var problem problemDetails
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Expected JSON body, got %q: %v", w.Body.String(), err)
+		}
+		if problem.Status != http.StatusBadGateway {
+			t.Errorf("Expected status 502 in problem details, got %d", problem.Status)
+		}
+	})
+}
+
+func TestAgeHeader(t *testing.T) {
+	t.Run("Cache hit reports non-zero age", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 3600}
+		app := &App{
+			config: config,
+			cache:  NewCache(config.GetCacheTTL()),
+		}
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"etag"`)
+		app.cache.entries["/openid/v1/jwks"].CreatedAt = time.Now().Add(-30 * time.Second)
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if age := w.Header().Get("Age"); age != "30" {
+			t.Errorf("Expected Age 30, got %q", age)
+		}
+	})
+
+	t.Run("Cache miss reports zero age", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 3600}
+		app := &App{
+			config:         config,
+			cache:          NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if age := w.Header().Get("Age"); age != "0" {
+			t.Errorf("Expected Age 0, got %q", age)
+		}
+	})
+}
+
+func TestExpiresSkew(t *testing.T) {
+	tests := []struct {
+		name       string
+		skew       int
+		expectedIn time.Duration
+	}{
+		{"No skew", 0, 3600 * time.Second},
+		{"Skew subtracted", 300, 3300 * time.Second},
+		{"Skew larger than TTL", 7200, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{
+				config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 3600, ExpiresSkewSeconds: tt.skew},
+				cache:  NewCache(60 * time.Second),
+			}
+			app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"etag"`)
+			captureLogs(t)
+
+			before := time.Now().Truncate(time.Second)
+			w := httptest.NewRecorder()
+			app.HandleJWKS(w, httptest.NewRequest("GET", "/openid/v1/jwks", nil))
+
+			expires, err := http.ParseTime(w.Header().Get("Expires"))
+			if err != nil {
+				t.Fatalf("Failed to parse Expires: %v", err)
+			}
+			if d := expires.Sub(before); d < tt.expectedIn || d > tt.expectedIn+2*time.Second {
+				t.Errorf("Expected Expires about %v ahead, got %v", tt.expectedIn, d)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+				t.Errorf("Expected max-age unaffected by skew, got %q", cc)
+			}
+		})
+	}
+}
+
+func TestOptionsMethod(t *testing.T) {
+	tests := []struct {
+		path        string
+		handler     func(*App) func(http.ResponseWriter, *http.Request)
+		allowReject string
+		allowAllow  string
+	}{
+		{"/.well-known/openid-configuration", func(a *App) func(http.ResponseWriter, *http.Request) { return a.HandleOIDCDiscovery }, "GET", "GET, OPTIONS"},
+		{"/openid/v1/jwks", func(a *App) func(http.ResponseWriter, *http.Request) { return a.HandleJWKS }, "GET", "GET, OPTIONS"},
+		{"/healthz", func(a *App) func(http.ResponseWriter, *http.Request) { return a.HandleHealthz }, "GET, HEAD", "GET, HEAD, OPTIONS"},
+		{"/readyz", func(a *App) func(http.ResponseWriter, *http.Request) { return a.HandleReadyz }, "GET, HEAD", "GET, HEAD, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run("Allow mode answers OPTIONS on "+tt.path, func(t *testing.T) {
+			app := &App{config: &Config{OptionsMode: OptionsModeAllow}}
+
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			w := httptest.NewRecorder()
+			tt.handler(app)(w, req)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("Expected status 204, got %d", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allowAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.allowAllow, allow)
+			}
+		})
+
+		t.Run("Reject mode returns 405 on "+tt.path, func(t *testing.T) {
+			app := &App{config: &Config{OptionsMode: OptionsModeReject}}
+
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			w := httptest.NewRecorder()
+			tt.handler(app)(w, req)
+
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status 405, got %d", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allowReject {
+				t.Errorf("Expected Allow %q, got %q", tt.allowReject, allow)
+			}
+		})
+	}
+}
+
+func TestReadyzDependency(t *testing.T) {
+	tests := []struct {
+		name             string
+		dependencyStatus int
+		expectedStatus   int
+	}{
+		{"Healthy dependency keeps readiness up", http.StatusOK, http.StatusOK},
+		{"Failing dependency fails readiness", http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dependency := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.dependencyStatus)
+			}))
+			defer dependency.Close()
+
+			config := &Config{
+				CacheTTLSeconds:                60,
+				DependencyHealthURL:            dependency.URL,
+				DependencyHealthTimeoutSeconds: 1,
+			}
+			app := &App{
+				config:         config,
+				cache:          NewCache(config.GetCacheTTL()),
+				upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+			}
+
+			req := httptest.NewRequest("GET", "/readyz", nil)
+			w := httptest.NewRecorder()
+			app.HandleReadyz(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestReadyzColdVersusDegraded(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	buf := captureLogs(t)
+
+	readyz := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.HandleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w
+	}
+
+	cold := readyz()
+	if cold.Code != http.StatusServiceUnavailable || !strings.Contains(cold.Body.String(), "cold start") {
+		t.Errorf("Expected cold start 503, got %d %s", cold.Code, cold.Body.String())
+	}
+
+	failing.Store(false)
+	if ready := readyz(); ready.Code != http.StatusOK {
+		t.Fatalf("Expected readiness once warm, got %d", ready.Code)
+	}
+
+	failing.Store(true)
+	degraded := readyz()
+	if degraded.Code != http.StatusServiceUnavailable || !strings.Contains(degraded.Body.String(), "degraded") {
+		t.Errorf("Expected degraded 503, got %d %s", degraded.Code, degraded.Body.String())
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, "state=cold") || !strings.Contains(logs, "state=degraded") {
+		t.Errorf("Expected both states to be logged, got %s", logs)
+	}
+}
+
+func TestSeedCache(t *testing.T) {
+	writeSeed := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "seed.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write seed file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("Seed files are served before any upstream fetch", func(t *testing.T) {
+		config := &Config{
+			CacheTTLSeconds:   60,
+			SeedDiscoveryFile: writeSeed(t, `{"issuer":"https://seeded.example.com"}`),
+			SeedJWKSFile:      writeSeed(t, `{"keys":[]}`),
+		}
+		app := &App{config: config, cache: NewCache(config.GetCacheTTL())}
+
+		if err := app.seedCache(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		req := httptest.NewRequest("GET", "/.well-known/openid-configuration", nil)
+		w := httptest.NewRecorder()
+		app.HandleOIDCDiscovery(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if w.Body.String() != `{"issuer":"https://seeded.example.com"}` {
+			t.Errorf("Expected seeded discovery document, got %s", w.Body.String())
+		}
+		if _, _, found := app.cache.Get("/openid/v1/jwks"); !found {
+			t.Error("Expected JWKS to be seeded")
+		}
+	})
+
+	t.Run("Invalid seed JSON fails startup", func(t *testing.T) {
+		config := &Config{
+			CacheTTLSeconds: 60,
+			SeedJWKSFile:    writeSeed(t, `{not json`),
+		}
+		app := &App{config: config, cache: NewCache(config.GetCacheTTL())}
+
+		if err := app.seedCache(); err == nil {
+			t.Error("Expected error for invalid seed JSON")
+		}
+	})
+
+	t.Run("Missing seed file fails startup", func(t *testing.T) {
+		config := &Config{
+			CacheTTLSeconds:   60,
+			SeedDiscoveryFile: filepath.Join(t.TempDir(), "missing.json"),
+		}
+		app := &App{config: config, cache: NewCache(config.GetCacheTTL())}
+
+		if err := app.seedCache(); err == nil {
+			t.Error("Expected error for missing seed file")
+		}
+	})
+}
+
+func TestMinJWKSKeys(t *testing.T) {
+	singleKeyUpstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[{"kid":"key-1"}]}`))
+	}
+
+	t.Run("JWKS with fewer keys than the minimum serves stale", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, MinJWKSKeys: 2}
+		app := &App{
+			config:         config,
+			cache:          NewCache(-time.Second),
+			upstreamClient: newTestUpstreamClient(t, singleKeyUpstream),
+		}
+		staleBody := []byte(`{"keys":[{"kid":"key-1"},{"kid":"key-2"}]}`)
+		app.cache.Set("/openid/v1/jwks", staleBody, `"stale"`)
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if w.Body.String() != string(staleBody) {
+			t.Errorf("Expected stale body, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("JWKS with fewer keys than the minimum and no cache fails", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, MinJWKSKeys: 2}
+		app := &App{
+			config:         config,
+			cache:          NewCache(config.GetCacheTTL()),
+			upstreamClient: newTestUpstreamClient(t, singleKeyUpstream),
+		}
+
+		req := httptest.NewRequest("GET", "/openid/v1/jwks", nil)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status 502, got %d", w.Code)
+		}
+		if _, _, found := app.cache.GetStale("/openid/v1/jwks"); found {
+			t.Error("Expected invalid JWKS not to be cached")
+		}
+	})
+}
+
+func TestClientNoCache(t *testing.T) {
+	newApp := func(t *testing.T, honor bool) (*App, *atomic.Int32) {
+		var upstreamCalls atomic.Int32
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60, HonorClientNoCache: honor},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalls.Add(1)
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[{"kid":"old"}]}`), `"old"`)
+		return app, &upstreamCalls
+	}
+
+	noCacheRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+		req.Header.Set("Cache-Control", "max-age=0, No-Cache")
+		return req
+	}
+
+	t.Run("Ignored by default", func(t *testing.T) {
+		app, upstreamCalls := newApp(t, false)
+		captureLogs(t)
+
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, noCacheRequest())
+
+		if upstreamCalls.Load() != 0 {
+			t.Errorf("Expected no upstream calls, got %d", upstreamCalls.Load())
+		}
+		if w.Header().Get("ETag") != `"old"` {
+			t.Errorf("Expected cached response, got ETag %s", w.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("Forces upstream fetch and refreshes cache when enabled", func(t *testing.T) {
+		app, upstreamCalls := newApp(t, true)
+		captureLogs(t)
+
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, noCacheRequest())
+
+		if upstreamCalls.Load() != 1 {
+			t.Errorf("Expected 1 upstream call, got %d", upstreamCalls.Load())
+		}
+		entry, found := app.cache.GetEntry("/openid/v1/jwks")
+		if !found || entry.ETag == `"old"` {
+			t.Error("Expected cache to be refreshed")
+		}
+		if w.Header().Get("ETag") != entry.ETag {
+			t.Errorf("Expected response ETag %s, got %s", entry.ETag, w.Header().Get("ETag"))
+		}
+
+		// Requests without the directive are served from the refreshed cache
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		if upstreamCalls.Load() != 1 {
+			t.Errorf("Expected no further upstream calls, got %d", upstreamCalls.Load())
+		}
+	})
+
+	t.Run("Bypassing requests do not extend a sliding expiration", func(t *testing.T) {
+		app, _ := newApp(t, true)
+		app.upstreamClient = newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		app.cache.SetSlidingExpiration(time.Hour)
+		app.cache.SetAt("/openid/v1/jwks", []byte(`{"keys":[{"kid":"old"}]}`), `"old"`, time.Now().Add(-30*time.Second), "")
+		before, _ := app.cache.GetEntry("/openid/v1/jwks")
+		captureLogs(t)
+
+		for i := 0; i < 3; i++ {
+			app.HandleJWKS(httptest.NewRecorder(), noCacheRequest())
+		}
+
+		after, found := app.cache.GetEntry("/openid/v1/jwks")
+		if !found || !after.ExpiresAt.Equal(before.ExpiresAt) {
+			t.Errorf("Expected ExpiresAt to stay %v, got %v", before.ExpiresAt, after.ExpiresAt)
+		}
+	})
+}
+
+func TestUpstreamDurationHeader(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("DebugHeaders=%v", enabled), func(t *testing.T) {
+			app := &App{
+				config:         &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60, DebugHeaders: enabled},
+				cache:          NewCache(60 * time.Second),
+				upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+			}
+			captureLogs(t)
+
+			miss := httptest.NewRecorder()
+			app.HandleJWKS(miss, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+			_, present := miss.Header()["X-Upstream-Duration-Ms"]
+			if present != enabled {
+				t.Errorf("Expected header present=%v on miss, got %v", enabled, present)
+			}
+			if enabled {
+				if _, err := strconv.Atoi(miss.Header().Get("X-Upstream-Duration-Ms")); err != nil {
+					t.Errorf("Expected integer duration, got %q", miss.Header().Get("X-Upstream-Duration-Ms"))
+				}
+			}
+
+			hit := httptest.NewRecorder()
+			app.HandleJWKS(hit, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+			if hit.Header().Get("X-Upstream-Duration-Ms") != "" {
+				t.Error("Expected no upstream duration header on cache hit")
+			}
+
+			if miss.Header().Get("X-Cache-Expires") != "" {
+				t.Error("Expected no cache expiry header on cache miss")
+			}
+			expires := hit.Header().Get("X-Cache-Expires")
+			if (expires != "") != enabled {
+				t.Errorf("Expected cache expiry header present=%v on hit, got %q", enabled, expires)
+			}
+			if enabled {
+				entry, _ := app.cache.GetEntry("/openid/v1/jwks")
+				if expires != entry.ExpiresAt.UTC().Format(time.RFC3339) {
+					t.Errorf("Expected cache expiry %s, got %q", entry.ExpiresAt.UTC().Format(time.RFC3339), expires)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamAuthRejected(t *testing.T) {
+	t.Run("Token rejection is logged distinctly and served as a generic 502", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}),
+		}
+		buf := captureLogs(t)
+
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status 502, got %d", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "token") {
+			t.Errorf("Expected generic client response, got %s", w.Body.String())
+		}
+		if !strings.Contains(buf.String(), "ERROR upstream_auth_rejected path=/openid/v1/jwks") {
+			t.Errorf("Expected upstream_auth_rejected log, got %s", buf.String())
+		}
+	})
+}
+
+func TestValidateKeyMaterial(t *testing.T) {
+	t.Run("Malformed key material is not cached and fails with 502", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, ValidateKeyMaterial: true, FailMode: FailModeOpen},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"keys":[{"kid":"key-1","kty":"RSA","n":"bad+base64=","e":"AQAB"}]}`))
+			}),
+		}
+		buf := captureLogs(t)
+
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status 502, got %d", w.Code)
+		}
+		if _, found := app.cache.GetStaleEntry("/openid/v1/jwks"); found {
+			t.Error("Expected malformed JWKS not to be cached")
+		}
+		if !strings.Contains(buf.String(), "upstream_document_invalid") {
+			t.Errorf("Expected upstream_document_invalid log, got %s", buf.String())
+		}
+	})
+}
+
+func TestAtomicOIDCRefresh(t *testing.T) {
+	newApp := func(t *testing.T, atomicRefresh bool) (*App, *atomic.Int32, *atomic.Int32) {
+		var discoveryFetches, jwksFetches atomic.Int32
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, AtomicOIDCRefresh: atomicRefresh, OIDCRefreshSkewSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/.well-known/openid-configuration":
+					discoveryFetches.Add(1)
+				case "/openid/v1/jwks":
+					jwksFetches.Add(1)
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		// Discovery was cached two hours ago and is still being served
+		app.cache.Set("/.well-known/openid-configuration", []byte(`{"old":true}`), `"old"`)
+		app.cache.entries["/.well-known/openid-configuration"].CreatedAt = time.Now().Add(-2 * time.Hour)
+		return app, &discoveryFetches, &jwksFetches
+	}
+
+	t.Run("JWKS refresh past the skew refreshes discovery too", func(t *testing.T) {
+		app, discoveryFetches, jwksFetches := newApp(t, true)
+
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		app.pairRefreshes.Wait()
+
+		if discoveryFetches.Load() != 1 {
+			t.Errorf("Expected discovery to be re-fetched once, got %d", discoveryFetches.Load())
+		}
+		if jwksFetches.Load() != 1 {
+			t.Errorf("Expected JWKS not to be fetched again, got %d fetches", jwksFetches.Load())
+		}
+		discovery, _ := app.cache.GetStaleEntry("/.well-known/openid-configuration")
+		jwks, _ := app.cache.GetStaleEntry("/openid/v1/jwks")
+		if discovery.ETag == `"old"` {
+			t.Error("Expected discovery to be refreshed")
+		}
+		if skew := jwks.CreatedAt.Sub(discovery.CreatedAt).Abs(); skew > time.Second {
+			t.Errorf("Expected documents to be refreshed together, skew %v", skew)
+		}
+	})
+
+	t.Run("Sibling is refreshed after the response with the request's audit ID", func(t *testing.T) {
+		release := make(chan struct{})
+		var auditID atomic.Value
+		app, _, _ := newApp(t, true)
+		app.config.PropagateRequestID = true
+		app.config.RequestBudgetMS = 5000
+		app.upstreamClient = newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/.well-known/openid-configuration" {
+				auditID.Store(r.Header.Get("Audit-ID"))
+				<-release
+			}
+			oidcUpstreamHandler(w, r)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+		req.Header.Set("X-Request-Id", "req-1")
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		// The response is complete while the discovery fetch is still held upstream
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if discovery, _ := app.cache.GetStaleEntry("/.well-known/openid-configuration"); discovery.ETag != `"old"` {
+			t.Error("Expected discovery to be refreshed only after the response")
+		}
+
+		close(release)
+		app.pairRefreshes.Wait()
+		if discovery, _ := app.cache.GetStaleEntry("/.well-known/openid-configuration"); discovery.ETag == `"old"` {
+			t.Error("Expected discovery to be refreshed in the background")
+		}
+		if got, _ := auditID.Load().(string); got != "req-1" {
+			t.Errorf("Expected the sibling fetch to carry Audit-ID req-1, got %q", got)
+		}
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		app, discoveryFetches, _ := newApp(t, false)
+
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		if discoveryFetches.Load() != 0 {
+			t.Errorf("Expected no discovery fetch, got %d", discoveryFetches.Load())
+		}
+	})
+}
+
+func TestContentTypePerPath(t *testing.T) {
+	app := &App{
+		config: &Config{
+			CacheTTLSeconds: 60,
+			JWKSContentType: "application/jwk-set+json",
+		},
+		cache: NewCache(60 * time.Second),
+	}
+	app.cache.Set("/.well-known/openid-configuration", []byte(`{}`), `"d"`)
+	app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`)
+	captureLogs(t)
+
+	tests := []struct {
+		path        string
+		handler     http.HandlerFunc
+		contentType string
+	}{
+		{"/.well-known/openid-configuration", app.HandleOIDCDiscovery, "application/json"},
+		{"/openid/v1/jwks", app.HandleJWKS, "application/jwk-set+json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.contentType, ct)
+			}
+		})
+	}
+}
+
+func TestDegradedStart(t *testing.T) {
+	missingToken := func(t *testing.T, degraded bool) *Config {
+		return &Config{
+			CacheTTLSeconds: 60,
+			FailMode:        FailModeOpen,
+			SATokenPath:     filepath.Join(t.TempDir(), "missing-token"),
+			SACACertPath:    filepath.Join(t.TempDir(), "missing-ca"),
+			DegradedStart:   degraded,
+		}
+	}
+
+	t.Run("Initialization failure is fatal by default", func(t *testing.T) {
+		captureLogs(t)
+		if _, err := NewApp(missingToken(t, false)); err == nil {
+			t.Error("Expected NewApp to fail")
+		}
+	})
+
+	t.Run("Degraded start stays alive but not ready", func(t *testing.T) {
+		captureLogs(t)
+		app, err := NewApp(missingToken(t, true))
+		if err != nil {
+			t.Fatalf("Expected degraded start to succeed, got %v", err)
+		}
+
+		healthz := httptest.NewRecorder()
+		app.HandleHealthz(healthz, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if healthz.Code != http.StatusOK {
+			t.Errorf("Expected healthz 200, got %d", healthz.Code)
+		}
+
+		readyz := httptest.NewRecorder()
+		app.HandleReadyz(readyz, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if readyz.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected readyz 503, got %d", readyz.Code)
+		}
+		if !strings.Contains(readyz.Body.String(), "service account token") {
+			t.Errorf("Expected readiness reason, got %s", readyz.Body.String())
+		}
+
+		jwks := httptest.NewRecorder()
+		app.HandleJWKS(jwks, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		if jwks.Code != http.StatusBadGateway {
+			t.Errorf("Expected JWKS 502 without upstream, got %d", jwks.Code)
+		}
+	})
+}
+
+func TestLogSampleRate(t *testing.T) {
+	t.Run("Successful requests are sampled", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, LogSampleRate: 3},
+			cache:  NewCache(60 * time.Second),
+		}
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`)
+		buf := captureLogs(t)
+
+		for i := 0; i < 6; i++ {
+			app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		}
+
+		if lines := strings.Count(buf.String(), "path=/openid/v1/jwks status=200"); lines != 2 {
+			t.Errorf("Expected 2 sampled request logs, got %d: %s", lines, buf.String())
+		}
+	})
+
+	t.Run("Errors are always logged", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, LogSampleRate: 100, FailMode: FailModeClosed},
+			cache:  NewCache(60 * time.Second),
+		}
+		app.cacheOnly.Store(true)
+		buf := captureLogs(t)
+
+		for i := 0; i < 3; i++ {
+			app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		}
+
+		if lines := strings.Count(buf.String(), "path=/openid/v1/jwks status=503"); lines != 3 {
+			t.Errorf("Expected 3 error request logs, got %d: %s", lines, buf.String())
+		}
+	})
+}
+
+func TestUpstreamQuery(t *testing.T) {
+	t.Run("Query is sent upstream and keys the cache", func(t *testing.T) {
+		var requested atomic.Value
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, JWKSUpstreamQuery: "audience=gateway"},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requested.Store(r.URL.RequestURI())
+				w.Write([]byte(`{"keys":[]}`))
+			}),
+		}
+		captureLogs(t)
+
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		if got := requested.Load(); got != "/openid/v1/jwks?audience=gateway" {
+			t.Errorf("Expected upstream request with query, got %v", got)
+		}
+		if _, _, found := app.cache.Get("/openid/v1/jwks?audience=gateway"); !found {
+			t.Error("Expected cache entry keyed by path and query")
+		}
+		if _, _, found := app.cache.Get("/openid/v1/jwks"); found {
+			t.Error("Expected no cache entry for the bare path")
+		}
+	})
+
+	t.Run("Invalid query is rejected", func(t *testing.T) {
+		config := &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, DiscoveryUpstreamQuery: "a=%zz"}
+		if _, err := NewApp(config); err == nil || !strings.Contains(err.Error(), "invalid upstream query") {
+			t.Errorf("Expected invalid upstream query error, got %v", err)
+		}
+	})
+}
+
+func TestUpstreamDateFreshness(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("UpstreamDateFreshness=%v", enabled), func(t *testing.T) {
+			app := &App{
+				config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, UpstreamDateFreshness: enabled},
+				cache:  NewCache(60 * time.Second),
+				upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Age", "40")
+					w.Write([]byte(`{"keys":[]}`))
+				}),
+			}
+			captureLogs(t)
+
+			w := httptest.NewRecorder()
+			app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+			entry, found := app.cache.GetStaleEntry("/openid/v1/jwks")
+			if !found {
+				t.Fatal("Expected JWKS to be cached")
+			}
+			remaining := time.Until(entry.ExpiresAt)
+			if enabled && (remaining > 21*time.Second || remaining < 15*time.Second) {
+				t.Errorf("Expected about 20s of freshness left, got %v", remaining)
+			}
+			if !enabled && remaining < 55*time.Second {
+				t.Errorf("Expected a full TTL from the local receive time, got %v", remaining)
+			}
+			// The test server's Date header has one-second precision, adding up to a second
+			if age, _ := strconv.Atoi(w.Header().Get("Age")); enabled != (age >= 40) {
+				t.Errorf("Unexpected Age header %d", age)
+			}
+		})
+	}
+}
+
+func TestUpstreamHostLogging(t *testing.T) {
+	failing := atomic.Bool{}
+	client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		oidcUpstreamHandler(w, r)
+	})
+	app := &App{
+		config:         &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen},
+		cache:          NewCache(60 * time.Second),
+		upstreamClient: client,
+	}
+	host := strings.TrimPrefix(client.baseURL, "http://")
+	buf := captureLogs(t)
+	previousLevel := slog.SetLogLoggerLevel(slog.LevelDebug)
+	t.Cleanup(func() { slog.SetLogLoggerLevel(previousLevel) })
+
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	failing.Store(true)
+	app.HandleOIDCDiscovery(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+	logs := buf.String()
+	for _, expected := range []string{
+		"DEBUG upstream_fetch path=/openid/v1/jwks upstream_host=" + host,
+		"cache_hit=false duration_ms=",
+		"upstream_error path=/.well-known/openid-configuration upstream_host=" + host,
+	} {
+		if !strings.Contains(logs, expected) {
+			t.Errorf("Expected log containing %q, got %s", expected, logs)
+		}
+	}
+	if strings.Count(logs, "upstream_host=") != 4 {
+		t.Errorf("Expected the cache hit request log to omit upstream_host, got %s", logs)
+	}
+}
+
+func TestConditionalUpstreamRequests(t *testing.T) {
+	var downloads, notModified atomic.Int32
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, ConditionalUpstreamRequests: true},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"upstream-v1"`)
+			if r.Header.Get("If-None-Match") == `"upstream-v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads.Add(1)
+			w.Write([]byte(`{"keys":[{"kid":"a"}]}`))
+		}),
+	}
+	buf := captureLogs(t)
+
+	first := httptest.NewRecorder()
+	app.HandleJWKS(first, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+	// Expire the entry so the next request revalidates it
+	app.cache.entries["/openid/v1/jwks"].ExpiresAt = time.Now().Add(-time.Second)
+	app.cache.entries["/openid/v1/jwks"].CreatedAt = time.Now().Add(-time.Minute)
+
+	second := httptest.NewRecorder()
+	app.HandleJWKS(second, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+	if second.Code != http.StatusOK {
+		t.Fatalf("Expected 200 after revalidation, got %d", second.Code)
+	}
+	if downloads.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("Expected 1 download and 1 revalidation, got %d and %d", downloads.Load(), notModified.Load())
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Error("Expected the renewed response to match the original")
+	}
+	if second.Header().Get("Age") != "0" {
+		t.Errorf("Expected renewal to reset Age, got %q", second.Header().Get("Age"))
+	}
+	entry, found := app.cache.GetEntry("/openid/v1/jwks")
+	if !found || time.Until(entry.ExpiresAt) < 55*time.Second {
+		t.Error("Expected the entry to be fresh again")
+	}
+	if !strings.Contains(buf.String(), "upstream_not_modified path=/openid/v1/jwks") {
+		t.Errorf("Expected upstream_not_modified log, got %s", buf.String())
+	}
+}
+
+func TestUpstreamErrorEscalation(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, UpstreamErrorEscalationThreshold: 3},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	buf := captureLogs(t)
+
+	for i := 0; i < 4; i++ {
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	}
+	logs := buf.String()
+	if count := strings.Count(logs, "WARN upstream_error "); count != 2 {
+		t.Errorf("Expected 2 warning lines below the threshold, got %d: %s", count, logs)
+	}
+	if !strings.Contains(logs, "ERROR upstream_error path=/openid/v1/jwks") || !strings.Contains(logs, "consecutive_failures=4") {
+		t.Errorf("Expected escalated error lines, got %s", logs)
+	}
+
+	failing.Store(false)
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	if !strings.Contains(buf.String(), "upstream_recovered consecutive_failures=4") {
+		t.Errorf("Expected recovery log, got %s", buf.String())
+	}
+	if app.upstreamFailures.Load() != 0 {
+		t.Error("Expected the failure count to reset on recovery")
+	}
+
+	// Probes count failures and observe recoveries just like client requests
+	failing.Store(true)
+	for i := 0; i < 3; i++ {
+		app.populateCache()
+	}
+	if failures := app.upstreamFailures.Load(); failures != 3 {
+		t.Errorf("Expected failed probes to be counted, got %d", failures)
+	}
+	failing.Store(false)
+	if err := app.populateCache(); err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "upstream_recovered consecutive_failures=3") || app.upstreamFailures.Load() != 0 {
+		t.Errorf("Expected a successful probe to reset the failure count, got %s", buf.String())
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	slowUpstream := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			oidcUpstreamHandler(w, r)
+		case <-r.Context().Done():
+		}
+	}
+
+	tests := []struct {
+		name           string
+		cached         bool
+		expectedStatus int
+	}{
+		{"Exceeded budget with empty cache returns 503", false, http.StatusServiceUnavailable},
+		{"Exceeded budget serves stale cache", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{
+				config:         &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, RequestBudgetMS: 50},
+				cache:          NewCache(-time.Second),
+				upstreamClient: newTestUpstreamClient(t, slowUpstream),
+			}
+			if tt.cached {
+				app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"stale"`)
+			}
+			buf := captureLogs(t)
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the request to end near its budget, took %v", elapsed)
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if !strings.Contains(buf.String(), "request_budget_exceeded path=/openid/v1/jwks budget_ms=50") {
+				t.Errorf("Expected budget log, got %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestCacheStatusHeader(t *testing.T) {
+	var failing atomic.Bool
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, CacheStatusHeader: true},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	captureLogs(t)
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		return w
+	}
+
+	t.Run("Miss fetches from upstream", func(t *testing.T) {
+		if got := request().Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("Expected X-Cache MISS, got %q", got)
+		}
+	})
+
+	t.Run("Hit serves fresh cache", func(t *testing.T) {
+		if got := request().Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("Expected X-Cache HIT, got %q", got)
+		}
+	})
+
+	t.Run("Upstream failure serves stale cache", func(t *testing.T) {
+		failing.Store(true)
+		app.cache.entries["/openid/v1/jwks"].ExpiresAt = time.Now().Add(-time.Second)
+		w := request()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if got := w.Header().Get("X-Cache"); got != "STALE" {
+			t.Errorf("Expected X-Cache STALE, got %q", got)
+		}
+	})
+
+	t.Run("Disabled omits the header", func(t *testing.T) {
+		app.config.CacheStatusHeader = false
+		if got := request().Header().Get("X-Cache"); got != "" {
+			t.Errorf("Expected no X-Cache header, got %q", got)
+		}
+	})
+}
+
+func TestStaleWarningHeader(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("StaleWarningHeader=%v", enabled), func(t *testing.T) {
+			var failing atomic.Bool
+			app := &App{
+				config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, CacheStatusHeader: true, StaleWarningHeader: enabled},
+				cache:  NewCache(60 * time.Second),
+				upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+					if failing.Load() {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					oidcUpstreamHandler(w, r)
+				}),
+			}
+			captureLogs(t)
+
+			fresh := httptest.NewRecorder()
+			app.HandleJWKS(fresh, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+			if got := fresh.Header().Get("Warning"); got != "" {
+				t.Errorf("Expected no Warning on a fresh response, got %q", got)
+			}
+
+			failing.Store(true)
+			app.cache.entries["/openid/v1/jwks"].ExpiresAt = time.Now().Add(-time.Second)
+			stale := httptest.NewRecorder()
+			app.HandleJWKS(stale, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+			if stale.Header().Get("X-Cache") != "STALE" {
+				t.Fatalf("Expected the stale path, got X-Cache %q", stale.Header().Get("X-Cache"))
+			}
+			expected := ""
+			if enabled {
+				expected = `110 - "Response is Stale"`
+			}
+			if got := stale.Header().Get("Warning"); got != expected {
+				t.Errorf("Expected Warning %q, got %q", expected, got)
+			}
+		})
+	}
+
+	t.Run("KeepsDeprecatedPathWarning", func(t *testing.T) {
+		var failing atomic.Bool
+		app := &App{
+			config: &Config{
+				CacheTTLSeconds:    60,
+				FailMode:           FailModeOpen,
+				StaleWarningHeader: true,
+				DeprecatedPaths:    []string{"/openid/v1/jwks"},
+			},
+			cache: NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+		handler := app.WarnDeprecatedPaths(http.HandlerFunc(app.HandleJWKS))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		failing.Store(true)
+		app.cache.entries["/openid/v1/jwks"].ExpiresAt = time.Now().Add(-time.Second)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		expected := []string{`299 - "Deprecated path, migrate to a supported endpoint"`, `110 - "Response is Stale"`}
+		if got := w.Header().Values("Warning"); !slices.Equal(got, expected) {
+			t.Errorf("Expected Warning values %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 300},
+		cache:  NewCache(60 * time.Second),
+	}
+	app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"jwks-etag"`)
+	captureLogs(t)
+
+	t.Run("Matching ETag returns 304 without a body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+		req.Header.Set("If-None-Match", `W/"jwks-etag"`)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("Expected status 304, got %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("Expected no body, got %s", w.Body.String())
+		}
+		if w.Header().Get("ETag") != `"jwks-etag"` {
+			t.Errorf("Expected ETag header, got %q", w.Header().Get("ETag"))
+		}
+		if w.Header().Get("Cache-Control") != "public, max-age=300" {
+			t.Errorf("Expected Cache-Control header, got %q", w.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("Different ETag returns the document", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+		req.Header.Set("If-None-Match", `"old-etag"`)
+		w := httptest.NewRecorder()
+		app.HandleJWKS(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != `{"keys":[]}` {
+			t.Errorf("Expected 200 with the document, got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, SlowRequestThresholdMS: 50},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	buf := captureLogs(t)
+
+	// The miss waits on the slow upstream; the following hit is served from cache
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+	logs := buf.String()
+	if !strings.Contains(logs, "WARN slow_request path=/openid/v1/jwks status=200 cache_hit=false") || !strings.Contains(logs, "threshold_ms=50") {
+		t.Errorf("Expected the slow request to be logged, got %s", logs)
+	}
+	if strings.Contains(logs, "cache_hit=true") {
+		t.Errorf("Expected the fast request not to be logged, got %s", logs)
+	}
+}
+
+func TestBootstrapDiscovery(t *testing.T) {
+	const bootstrap = `{"issuer":"https://oidc.example.com","jwks_uri":"https://oidc.example.com/openid/v1/jwks"}`
+	var serving atomic.Bool
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen, BootstrapDiscoveryJSON: bootstrap},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if !serving.Load() {
+				http.NotFound(w, r)
+				return
+			}
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	buf := captureLogs(t)
+
+	t.Run("Bootstrap document is served until upstream succeeds", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.HandleOIDCDiscovery(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != bootstrap {
+			t.Errorf("Expected the bootstrap document, got %d %s", w.Code, w.Body.String())
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Expected Cache-Control no-store, got %q", w.Header().Get("Cache-Control"))
+		}
+		if !strings.Contains(buf.String(), "WARN serving_bootstrap_discovery path=/.well-known/openid-configuration") {
+			t.Errorf("Expected bootstrap warning, got %s", buf.String())
+		}
+
+		jwks := httptest.NewRecorder()
+		app.HandleJWKS(jwks, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		if jwks.Code != http.StatusBadGateway {
+			t.Errorf("Expected JWKS failures to be unaffected, got %d", jwks.Code)
+		}
+	})
+
+	t.Run("Real discovery replaces the bootstrap document for good", func(t *testing.T) {
+		serving.Store(true)
+		w := httptest.NewRecorder()
+		app.HandleOIDCDiscovery(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		if !strings.Contains(w.Body.String(), "kubernetes.default.svc") {
+			t.Fatalf("Expected the upstream document, got %s", w.Body.String())
+		}
+
+		// Later outages fall back to stale data or the fail mode, never the bootstrap document
+		serving.Store(false)
+		app.cache.Clear()
+		w = httptest.NewRecorder()
+		app.HandleOIDCDiscovery(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status 502 after a real fetch, got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Invalid bootstrap documents are rejected at startup", func(t *testing.T) {
+		for _, value := range []string{`not json`, `["x"]`} {
+			if _, err := NewApp(&Config{BootstrapDiscoveryJSON: value}); err == nil || !strings.Contains(err.Error(), "BOOTSTRAP_DISCOVERY_JSON") {
+				t.Errorf("Expected NewApp to reject %q, got %v", value, err)
+			}
+		}
+	})
+}
+
+func TestEnabledEndpointsValidation(t *testing.T) {
+	t.Run("Unknown endpoint names are rejected at startup", func(t *testing.T) {
+		for _, name := range []string{"jwks.json", "openid-configuration", "keys"} {
+			if _, err := NewApp(&Config{EnabledEndpoints: []string{EndpointJWKS, name}}); err == nil || !strings.Contains(err.Error(), "ENABLED_ENDPOINTS") {
+				t.Errorf("Expected NewApp to reject %q, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Endpoint names match case-insensitively", func(t *testing.T) {
+		captureLogs(t)
+		config := &Config{
+			EnabledEndpoints: []string{"JWKS", "Discovery"},
+			SATokenPath:      filepath.Join(t.TempDir(), "missing-token"),
+			SACACertPath:     filepath.Join(t.TempDir(), "missing-ca"),
+			DegradedStart:    true,
+		}
+		if _, err := NewApp(config); err != nil {
+			t.Errorf("Expected mixed-case endpoint names to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestPopulateCacheSingleFlight(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	app := &App{
+		config: &Config{CacheTTLSeconds: 60},
+		cache:  NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			oidcUpstreamHandler(w, r)
+		}),
+	}
+	captureLogs(t)
+
+	// The first population blocks on upstream while probes, warm-up and the checker pile on
+	errs := make(chan error, 5)
+	go func() { errs <- app.populateCache() }()
+	<-started
+	for i := 0; i < 4; i++ {
+		go func() { errs <- app.populateCache() }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected every caller to share a successful population, got %v", err)
+		}
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Expected one fetch per OIDC path, got %d", got)
+	}
+
+	// A later call starts a new population
+	if err := app.populateCache(); err != nil || fetches.Load() != 4 {
+		t.Errorf("Expected a fresh population after the first completed, got %v with %d fetches", err, fetches.Load())
+	}
 }
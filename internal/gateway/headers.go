@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are the connection-specific headers defined by RFC 7230 section 6.1
+// that must not be forwarded by a proxy
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders deletes the standard hop-by-hop headers and any
+// additional headers listed in the Connection header
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// closesConnection reports whether the connection ends after this response: an HTTP/1.0
+// client that did not ask for keep-alive. Such clients get an explicit Connection: close
+// since some legacy tools wait for it rather than assuming the HTTP/1.0 default.
+func closesConnection(r *http.Request) bool {
+	if r.ProtoMajor != 1 || r.ProtoMinor != 0 {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "keep-alive") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header matches etag. Per RFC 9110 section
+// 13.1.2 the comparison is weak, so W/"x" and "x" match, and * matches any current entity.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxForwardedHeaderLength bounds header values copied from client requests to upstream
+const maxForwardedHeaderLength = 128
+
+// reservedUpstreamHeaders are set by the gateway itself and cannot be configured
+var reservedUpstreamHeaders = []string{"Authorization", "Host", "If-None-Match"}
+
+// parseUpstreamHeaders parses configured "Name=value" entries into headers to send with
+// every upstream request. Names must be valid tokens and values are sanitized.
+func parseUpstreamHeaders(entries []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isHeaderToken(name) {
+			return nil, fmt.Errorf("invalid upstream header %q: expected Name=value", entry)
+		}
+		for _, reserved := range reservedUpstreamHeaders {
+			if strings.EqualFold(name, reserved) {
+				return nil, fmt.Errorf("upstream header %s is set by the gateway and cannot be configured", reserved)
+			}
+		}
+		headers.Add(name, sanitizeHeaderValue(value))
+	}
+	return headers, nil
+}
+
+// isHeaderToken reports whether name is a valid HTTP header field name (RFC 9110 section 5.1)
+func isHeaderToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= 0x20 || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeHeaderValue drops control characters, which could otherwise split or corrupt
+// the header, and trims surrounding whitespace
+func sanitizeHeaderValue(value string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value))
+}
+
+// upstreamHeadersKey is the context key for per-request upstream headers
+type upstreamHeadersKey struct{}
+
+// withUpstreamHeader returns a context carrying an additional header for upstream requests made with it
+func withUpstreamHeader(ctx context.Context, name, value string) context.Context {
+	headers := http.Header{}
+	if existing, ok := ctx.Value(upstreamHeadersKey{}).(http.Header); ok {
+		headers = existing.Clone()
+	}
+	headers.Set(name, value)
+	return context.WithValue(ctx, upstreamHeadersKey{}, headers)
+}
+
+// upstreamHeadersFrom returns the per-request upstream headers carried by ctx, if any
+func upstreamHeadersFrom(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(upstreamHeadersKey{}).(http.Header)
+	return headers
+}
+
+const (
+	// requestIDHeader carries the client's request ID into the gateway
+	requestIDHeader = "X-Request-Id"
+	// auditIDHeader is recorded by the Kubernetes API server as the audit event ID,
+	// linking its audit log entries to the gateway request
+	auditIDHeader = "Audit-ID"
+)
+
+// upstreamContext returns the context for upstream fetches made on behalf of r, carrying
+// its sanitized request ID as the upstream audit ID when propagation is enabled
+func (a *App) upstreamContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if !a.config.PropagateRequestID {
+		return ctx
+	}
+
+	id := sanitizeHeaderValue(r.Header.Get(requestIDHeader))
+	if len(id) > maxForwardedHeaderLength {
+		id = id[:maxForwardedHeaderLength]
+	}
+	if id == "" {
+		return ctx
+	}
+	return withUpstreamHeader(ctx, auditIDHeader, id)
+}
@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	t.Run("Strips RFC 7230 hop-by-hop headers", func(t *testing.T) {
+		h := http.Header{}
+		for _, name := range hopByHopHeaders {
+			h.Set(name, "value")
+		}
+		h.Set("Content-Type", "application/json")
+
+		removeHopByHopHeaders(h)
+
+		for _, name := range hopByHopHeaders {
+			if h.Get(name) != "" {
+				t.Errorf("Expected %s to be removed", name)
+			}
+		}
+		if h.Get("Content-Type") != "application/json" {
+			t.Error("Expected end-to-end header to be preserved")
+		}
+	})
+
+	t.Run("Strips headers named in Connection", func(t *testing.T) {
+		h := http.Header{}
+		h.Add("Connection", "close, X-Custom-Hop")
+		h.Add("Connection", "X-Other-Hop")
+		h.Set("X-Custom-Hop", "1")
+		h.Set("X-Other-Hop", "1")
+		h.Set("ETag", `"abc"`)
+
+		removeHopByHopHeaders(h)
+
+		if h.Get("X-Custom-Hop") != "" || h.Get("X-Other-Hop") != "" {
+			t.Error("Expected headers listed in Connection to be removed")
+		}
+		if h.Get("ETag") != `"abc"` {
+			t.Error("Expected ETag to be preserved")
+		}
+	})
+	t.Run("JSON responses never carry hop-by-hop headers", func(t *testing.T) {
+		app := &App{config: &Config{ClientCacheTTLSeconds: 60}, cache: NewCache(time.Minute)}
+		w := httptest.NewRecorder()
+		w.Header().Set("Connection", "X-Internal")
+		w.Header().Set("X-Internal", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+
+		app.writeJSONResponse(w, httptest.NewRequest(http.MethodGet, jwksPath, nil), jwksPath, CacheEntry{Body: []byte(`{}`), ETag: `"e"`, CreatedAt: time.Now()}, http.StatusOK)
+
+		for _, name := range []string{"Connection", "X-Internal", "Keep-Alive"} {
+			if w.Header().Get(name) != "" {
+				t.Errorf("Expected %s to be stripped from response", name)
+			}
+		}
+		if w.Header().Get("ETag") != `"e"` {
+			t.Error("Expected ETag to be set")
+		}
+	})
+}
+
+func TestHTTP10Clients(t *testing.T) {
+	app := &App{config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60}, cache: NewCache(time.Minute)}
+	body := `{"keys":[` + strings.Repeat(`{"kid":"k"},`, 400) + `{"kid":"last"}]}`
+	app.cache.Set(jwksPath, []byte(body), `"e"`)
+	captureLogs(t)
+	server := httptest.NewServer(http.HandlerFunc(app.HandleJWKS))
+	t.Cleanup(server.Close)
+
+	request := func(t *testing.T, raw string) *http.Response {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if _, err := conn.Write([]byte(raw)); err != nil {
+			t.Fatalf("Failed to write request: %v", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("HTTP/1.0 gets Content-Length and Connection: close", func(t *testing.T) {
+		resp := request(t, "GET /openid/v1/jwks HTTP/1.0\r\n\r\n")
+
+		if resp.ContentLength != int64(len(body)) {
+			t.Errorf("Expected Content-Length %d, got %d", len(body), resp.ContentLength)
+		}
+		if resp.Header.Get("Connection") != "close" {
+			t.Errorf("Expected Connection: close, got %q", resp.Header.Get("Connection"))
+		}
+		if got, _ := io.ReadAll(resp.Body); string(got) != body {
+			t.Error("Expected the full body")
+		}
+	})
+
+	t.Run("HTTP/1.0 keep-alive is honored", func(t *testing.T) {
+		resp := request(t, "GET /openid/v1/jwks HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+
+		if resp.Header.Get("Connection") == "close" {
+			t.Error("Expected the connection to be kept alive")
+		}
+		if resp.ContentLength != int64(len(body)) {
+			t.Errorf("Expected Content-Length %d, got %d", len(body), resp.ContentLength)
+		}
+	})
+
+	t.Run("HTTP/1.1 is unaffected", func(t *testing.T) {
+		resp := request(t, "GET /openid/v1/jwks HTTP/1.1\r\nHost: gateway\r\n\r\n")
+
+		if resp.Header.Get("Connection") != "" {
+			t.Errorf("Expected no Connection header, got %q", resp.Header.Get("Connection"))
+		}
+		if resp.ContentLength != int64(len(body)) {
+			t.Errorf("Expected Content-Length %d, got %d", len(body), resp.ContentLength)
+		}
+	})
+}
+
+func TestParseUpstreamHeaders(t *testing.T) {
+	t.Run("Valid entries are sanitized", func(t *testing.T) {
+		headers, err := parseUpstreamHeaders([]string{"X-Gateway=kube-oidc-gateway", " X-Team = identity\r\nInjected: 1 "})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if headers.Get("X-Gateway") != "kube-oidc-gateway" {
+			t.Errorf("Unexpected X-Gateway %q", headers.Get("X-Gateway"))
+		}
+		if headers.Get("X-Team") != "identityInjected: 1" {
+			t.Errorf("Expected control characters to be removed, got %q", headers.Get("X-Team"))
+		}
+	})
+
+	for _, entry := range []string{"NoValue", "Bad Name=x", "=x", "authorization=Bearer other"} {
+		t.Run("Rejects "+entry, func(t *testing.T) {
+			if _, err := parseUpstreamHeaders([]string{entry}); err == nil {
+				t.Errorf("Expected %q to be rejected", entry)
+			}
+		})
+	}
+}
+
+func TestUpstreamRequestHeaders(t *testing.T) {
+	var received atomic.Value
+	client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Clone())
+		w.Write([]byte(`{"keys":[]}`))
+	})
+	client.headers = http.Header{"X-Gateway": {"kube-oidc-gateway"}}
+
+	for _, propagate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("PropagateRequestID=%v", propagate), func(t *testing.T) {
+			app := &App{
+				config:         &Config{CacheTTLSeconds: 60, PropagateRequestID: propagate},
+				cache:          NewCache(time.Minute),
+				upstreamClient: client,
+			}
+			captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+			req.Header.Set("X-Request-Id", "req-123\n"+strings.Repeat("a", 200))
+
+			app.HandleJWKS(httptest.NewRecorder(), req)
+
+			headers := received.Load().(http.Header)
+			if headers.Get("X-Gateway") != "kube-oidc-gateway" {
+				t.Error("Expected static header upstream")
+			}
+			if headers.Get("Authorization") != "Bearer test-token" {
+				t.Error("Expected the service account token to be kept")
+			}
+			auditID := headers.Get("Audit-ID")
+			if propagate && (!strings.HasPrefix(auditID, "req-123aaa") || len(auditID) != 128) {
+				t.Errorf("Expected sanitized, truncated Audit-ID, got %q", auditID)
+			}
+			if !propagate && auditID != "" {
+				t.Errorf("Expected no Audit-ID, got %q", auditID)
+			}
+		})
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		expected    bool
+	}{
+		{"Exact strong match", `"abc"`, `"abc"`, true},
+		{"Weak client tag matches strong ETag", `W/"abc"`, `"abc"`, true},
+		{"Strong client tag matches weak ETag", `"abc"`, `W/"abc"`, true},
+		{"Match within a list", `"x", "abc" , "y"`, `"abc"`, true},
+		{"Wildcard", `*`, `"abc"`, true},
+		{"Different tag", `"abd"`, `"abc"`, false},
+		{"Unquoted tag does not match", `abc`, `"abc"`, false},
+		{"Empty header", ``, `"abc"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.ifNoneMatch, tt.etag); got != tt.expected {
+				t.Errorf("etagMatches(%q, %q) = %v, expected %v", tt.ifNoneMatch, tt.etag, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StartIntegrityChecker periodically re-validates the cached OIDC documents until the
+// context is cancelled, refetching any that fail. It does nothing when the integrity
+// interval is not configured.
+func (a *App) StartIntegrityChecker(ctx context.Context) {
+	interval := a.config.GetCacheIntegrityInterval()
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.checkCacheIntegrity()
+			}
+		}
+	}()
+}
+
+// checkCacheIntegrity validates every cached OIDC document and refetches corrupted ones.
+// A corrupted entry is only replaced once its refetch succeeds, so that a failing upstream
+// never leaves the path with nothing to serve. It returns the number found corrupted.
+func (a *App) checkCacheIntegrity() int {
+	corrupted := 0
+	for _, path := range a.oidcPaths() {
+		entry, found := a.cache.GetStaleEntry(a.cacheKey(path))
+		if !found {
+			continue
+		}
+
+		if err := a.validateCachedEntry(path, entry); err != nil {
+			slog.Warn("cache_corrupted", "path", path, "etag", entry.ETag, "error", err)
+			corrupted++
+
+			// Download the document again; revalidating would only renew the corrupted copy
+			if a.cacheOnly.Load() {
+				err = fmt.Errorf("cache-only mode active")
+			} else {
+				err = a.refreshPath(context.Background(), path, false)
+			}
+			if err != nil {
+				slog.Warn("cache_integrity_refetch_failed", "path", path, "error", err)
+			}
+		}
+	}
+
+	return corrupted
+}
+
+// validateCachedEntry verifies that a cached body still matches its ETag, parses as JSON
+// and carries the fields clients depend on. With PRETTY_PRINT_FALLBACK_PASSTHROUGH the
+// cache may legitimately hold raw upstream bodies, so only the ETag is checked.
+func (a *App) validateCachedEntry(path string, entry CacheEntry) error {
+	if etag := computeETag(entry.Body); etag != entry.ETag {
+		return fmt.Errorf("body does not match ETag (computed %s)", etag)
+	}
+	if a.config.PrettyPrintFallbackPassthrough {
+		return nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(entry.Body, &doc); err != nil {
+		return fmt.Errorf("body is not a JSON object: %w", err)
+	}
+
+	var required []string
+	switch path {
+	case discoveryPath:
+		required = []string{"issuer", "jwks_uri"}
+	case jwksPath:
+		required = []string{"keys"}
+	}
+	for _, field := range required {
+		if _, ok := doc[field]; !ok {
+			return fmt.Errorf("missing required field %q", field)
+		}
+	}
+
+	return nil
+}
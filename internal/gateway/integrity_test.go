@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCacheIntegrity(t *testing.T) {
+	newApp := func(t *testing.T) *App {
+		return &App{
+			config:         &Config{CacheTTLSeconds: 60},
+			cache:          NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+	}
+	set := func(app *App, path, body string) {
+		app.cache.Set(path, []byte(body), computeETag([]byte(body)))
+	}
+
+	t.Run("Valid entries are kept", func(t *testing.T) {
+		app := newApp(t)
+		buf := captureLogs(t)
+		set(app, discoveryPath, `{"issuer":"x","jwks_uri":"y"}`)
+		set(app, jwksPath, `{"keys":[]}`)
+
+		if corrupted := app.checkCacheIntegrity(); corrupted != 0 {
+			t.Errorf("Expected no corrupted entries, got %d: %s", corrupted, buf.String())
+		}
+		if body, _, _ := app.cache.Get(discoveryPath); string(body) != `{"issuer":"x","jwks_uri":"y"}` {
+			t.Error("Expected the valid entry to be untouched")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		corrupt func(entry *CacheEntry)
+	}{
+		{"Body no longer matches its ETag", jwksPath, `{"keys":[]}`, func(entry *CacheEntry) { entry.Body[2] = 'X' }},
+		{"Missing required field", discoveryPath, `{"issuer":"x"}`, nil},
+		{"Not JSON", jwksPath, `keys`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(t)
+			buf := captureLogs(t)
+			set(app, tt.path, tt.body)
+			if tt.corrupt != nil {
+				tt.corrupt(app.cache.entries[tt.path])
+			}
+
+			if corrupted := app.checkCacheIntegrity(); corrupted != 1 {
+				t.Errorf("Expected 1 corrupted entry, got %d", corrupted)
+			}
+			if !strings.Contains(buf.String(), "cache_corrupted path="+tt.path) {
+				t.Errorf("Expected corruption to be logged, got %s", buf.String())
+			}
+
+			entry, found := app.cache.GetEntry(tt.path)
+			if !found {
+				t.Fatal("Expected the entry to be refetched")
+			}
+			if err := app.validateCachedEntry(tt.path, entry); err != nil {
+				t.Errorf("Expected refetched entry to be valid, got %v", err)
+			}
+		})
+	}
+	t.Run("Passthrough entries are only checked against their ETag", func(t *testing.T) {
+		app := newApp(t)
+		app.config.PrettyPrintFallbackPassthrough = true
+		captureLogs(t)
+		set(app, jwksPath, `not json`)
+
+		if corrupted := app.checkCacheIntegrity(); corrupted != 0 {
+			t.Errorf("Expected a raw passthrough body to be accepted, got %d corrupted", corrupted)
+		}
+		if body, _, _ := app.cache.Get(jwksPath); string(body) != `not json` {
+			t.Errorf("Expected the passthrough entry to be untouched, got %s", body)
+		}
+	})
+
+	t.Run("Corrupted entry is kept when the refetch fails", func(t *testing.T) {
+		app := newApp(t)
+		app.upstreamClient = newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		buf := captureLogs(t)
+		set(app, discoveryPath, `{"issuer":"x"}`)
+
+		if corrupted := app.checkCacheIntegrity(); corrupted != 1 {
+			t.Errorf("Expected 1 corrupted entry, got %d", corrupted)
+		}
+		if !strings.Contains(buf.String(), "cache_integrity_refetch_failed path="+discoveryPath) {
+			t.Errorf("Expected the failed refetch to be logged, got %s", buf.String())
+		}
+		if body, _, found := app.cache.GetStale(discoveryPath); !found || string(body) != `{"issuer":"x"}` {
+			t.Errorf("Expected the entry to be kept until a refetch succeeds, got %s", body)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// jwksKeyIDs returns the sorted key IDs of the keys in a JWKS document
+func jwksKeyIDs(body []byte) ([]string, error) {
+	var jwks struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	kids := make([]string, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.KeyID)
+	}
+	slices.Sort(kids)
+
+	return kids, nil
+}
+
+// sortJWKSKeys returns the JWKS document with its keys array ordered by kid, so that
+// reordering by the API server does not change the served bytes. Keys with equal
+// or missing kids keep their relative order.
+func sortJWKSKeys(body []byte) ([]byte, error) {
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	doc, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("JWKS is not a JSON object")
+	}
+	keys, ok := doc["keys"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("JWKS has no keys array")
+	}
+
+	slices.SortStableFunc(keys, func(a, b any) int {
+		return strings.Compare(keyID(a), keyID(b))
+	})
+
+	return json.Marshal(doc)
+}
+
+// keyID returns the kid of a decoded JWK, or an empty string if it has none
+func keyID(key any) string {
+	if jwk, ok := key.(map[string]any); ok {
+		if kid, ok := jwk["kid"].(string); ok {
+			return kid
+		}
+	}
+	return ""
+}
+
+// diffKeyIDs returns the key IDs present in next but not previous (added) and
+// present in previous but not next (removed)
+func diffKeyIDs(previous, next []string) (added, removed []string) {
+	added = []string{}
+	removed = []string{}
+
+	for _, kid := range next {
+		if !slices.Contains(previous, kid) {
+			added = append(added, kid)
+		}
+	}
+	for _, kid := range previous {
+		if !slices.Contains(next, kid) {
+			removed = append(removed, kid)
+		}
+	}
+
+	return added, removed
+}
+
+// auditKeyChange logs an audit event when the cached JWKS content changes,
+// recording the key IDs served before and after the change
+func (a *App) auditKeyChange(key string, previous *CacheEntry, current CacheEntry) {
+	if path, _, _ := strings.Cut(key, "?"); path != jwksPath {
+		return
+	}
+
+	previousETag := ""
+	previousKeyIDs := []string{}
+	if previous != nil {
+		previousETag = previous.ETag
+		if kids, err := jwksKeyIDs(previous.Body); err == nil {
+			previousKeyIDs = kids
+		}
+	}
+
+	currentKeyIDs, err := jwksKeyIDs(current.Body)
+	if err != nil {
+		slog.Warn("audit_key_change", "path", key, "old_etag", previousETag, "new_etag", current.ETag, "error", err)
+		return
+	}
+
+	added, removed := diffKeyIDs(previousKeyIDs, currentKeyIDs)
+	slog.Info("audit_key_change", "path", key, "old_etag", previousETag, "new_etag", current.ETag,
+		"old_kids", strings.Join(previousKeyIDs, ","), "new_kids", strings.Join(currentKeyIDs, ","),
+		"added", strings.Join(added, ","), "removed", strings.Join(removed, ","))
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWKSKeyIDs(t *testing.T) {
+	t.Run("Returns sorted key IDs", func(t *testing.T) {
+		kids, err := jwksKeyIDs([]byte(`{"keys":[{"kid":"b"},{"kid":"a"}]}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(kids, []string{"a", "b"}) {
+			t.Errorf("Expected [a b], got %v", kids)
+		}
+	})
+
+	t.Run("Invalid JSON returns error", func(t *testing.T) {
+		if _, err := jwksKeyIDs([]byte(`{not json`)); err == nil {
+			t.Error("Expected error for invalid JSON")
+		}
+	})
+}
+
+func TestDiffKeyIDs(t *testing.T) {
+	added, removed := diffKeyIDs([]string{"a", "b"}, []string{"b", "c"})
+	if !slices.Equal(added, []string{"c"}) {
+		t.Errorf("Expected added [c], got %v", added)
+	}
+	if !slices.Equal(removed, []string{"a"}) {
+		t.Errorf("Expected removed [a], got %v", removed)
+	}
+}
+
+func TestAuditKeyChange(t *testing.T) {
+	t.Run("Logs key changes for the JWKS path", func(t *testing.T) {
+		app := &App{config: &Config{}, cache: NewCache(60 * time.Second)}
+		app.cache.SetChangeHook(app.auditKeyChange)
+		buf := captureLogs(t)
+
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[{"kid":"a"},{"kid":"b"}]}`), `"v1"`)
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[{"kid":"b"},{"kid":"c"}]}`), `"v2"`)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 audit lines, got %d: %s", len(lines), buf.String())
+		}
+		if !strings.Contains(lines[1], `old_kids=a,b new_kids=b,c added=c removed=a`) {
+			t.Errorf("Unexpected audit line: %s", lines[1])
+		}
+	})
+
+	t.Run("Ignores other paths", func(t *testing.T) {
+		app := &App{config: &Config{}, cache: NewCache(60 * time.Second)}
+		app.cache.SetChangeHook(app.auditKeyChange)
+		buf := captureLogs(t)
+
+		app.cache.Set("/.well-known/openid-configuration", []byte(`{}`), `"v1"`)
+
+		if buf.Len() != 0 {
+			t.Errorf("Expected no audit log, got %s", buf.String())
+		}
+	})
+}
+
+func TestSortJWKSKeys(t *testing.T) {
+	t.Run("Reordered key sets produce identical output", func(t *testing.T) {
+		first := []byte(`{"keys":[{"kid":"b","e":"AQAB"},{"kid":"a","e":"AQAB"},{"kid":"c","e":"AQAB"}]}`)
+		second := []byte(`{"keys":[{"kid":"c","e":"AQAB"},{"kid":"a","e":"AQAB"},{"kid":"b","e":"AQAB"}]}`)
+
+		for _, pretty := range []bool{false, true} {
+			app := &App{config: &Config{SortJWKSKeys: true, PrettyPrintJSON: pretty}}
+
+			a, err := app.processBody(jwksPath, first)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			b, err := app.processBody(jwksPath, second)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(a) != string(b) || computeETag(a) != computeETag(b) {
+				t.Errorf("pretty=%v: expected identical output, got %s and %s", pretty, a, b)
+			}
+			if kids, _ := jwksKeyIDs(a); !slices.Equal(kids, []string{"a", "b", "c"}) {
+				t.Errorf("Unexpected kids %v", kids)
+			}
+			if !pretty && !strings.HasPrefix(string(a), `{"keys":[{"e":"AQAB","kid":"a"}`) {
+				t.Errorf("Expected keys sorted by kid, got %s", a)
+			}
+		}
+	})
+
+	t.Run("Upstream order is preserved by default", func(t *testing.T) {
+		app := &App{config: &Config{}}
+		body := []byte(`{"keys":[{"kid":"b"},{"kid":"a"}]}`)
+
+		result, err := app.processBody(jwksPath, body)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(result) != string(body) {
+			t.Errorf("Expected unchanged body, got %s", result)
+		}
+	})
+
+	t.Run("Document without keys array returns error", func(t *testing.T) {
+		if _, err := sortJWKSKeys([]byte(`{"keys":{}}`)); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// NewListener creates a TCP listener on addr. When a TCP keep-alive period is
+// configured it is applied to every accepted connection; otherwise Go's
+// defaults are used. A configured listen backlog replaces the OS default
+// (somaxconn) on platforms that support it.
+func NewListener(addr string, config *Config) (net.Listener, error) {
+	listenConfig := net.ListenConfig{
+		KeepAlive: config.GetTCPKeepAlive(),
+	}
+
+	listener, err := listenConfig.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ListenBacklog > 0 {
+		if err := setListenBacklog(listener, config.ListenBacklog); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set listen backlog: %w", err)
+		}
+	}
+
+	return listener, nil
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+// acceptedSocketOption dials the listener and reads a socket option from the accepted connection
+func acceptedSocketOption(t *testing.T, listener net.Listener, level, option int) int {
+	t.Helper()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial listener: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept connection: %v", err)
+	}
+	defer conn.Close()
+
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("Failed to get raw connection: %v", err)
+	}
+
+	var value int
+	var sockErr error
+	rawConn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, option)
+	})
+	if sockErr != nil {
+		t.Fatalf("Failed to read socket option: %v", sockErr)
+	}
+	return value
+}
+
+func TestNewListenerKeepAlive(t *testing.T) {
+	t.Run("Configured keep-alive period is applied to accepted connections", func(t *testing.T) {
+		listener, err := NewListener("127.0.0.1:0", &Config{TCPKeepAliveSeconds: 42})
+		if err != nil {
+			t.Fatalf("Failed to create listener: %v", err)
+		}
+		defer listener.Close()
+
+		if enabled := acceptedSocketOption(t, listener, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); enabled == 0 {
+			t.Error("Expected SO_KEEPALIVE to be enabled")
+		}
+		if idle := acceptedSocketOption(t, listener, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); idle != 42 {
+			t.Errorf("Expected TCP_KEEPIDLE 42, got %d", idle)
+		}
+	})
+
+	t.Run("Keep-alive is enabled by default", func(t *testing.T) {
+		listener, err := NewListener("127.0.0.1:0", &Config{})
+		if err != nil {
+			t.Fatalf("Failed to create listener: %v", err)
+		}
+		defer listener.Close()
+
+		if enabled := acceptedSocketOption(t, listener, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); enabled == 0 {
+			t.Error("Expected SO_KEEPALIVE to be enabled")
+		}
+	})
+}
+
+func TestNewListenerBacklog(t *testing.T) {
+	t.Run("Listener with a custom backlog accepts connections", func(t *testing.T) {
+		listener, err := NewListener("127.0.0.1:0", &Config{ListenBacklog: 16})
+		if err != nil {
+			t.Fatalf("Failed to create listener: %v", err)
+		}
+		defer listener.Close()
+
+		if sockType := acceptedSocketOption(t, listener, syscall.SOL_SOCKET, syscall.SO_TYPE); sockType != syscall.SOCK_STREAM {
+			t.Errorf("Expected accepted stream socket, got type %d", sockType)
+		}
+
+		rawConn, err := listener.(*net.TCPListener).SyscallConn()
+		if err != nil {
+			t.Fatalf("Failed to get raw listener: %v", err)
+		}
+		var accepting int
+		rawConn.Control(func(fd uintptr) {
+			accepting, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+		})
+		if accepting == 0 {
+			t.Error("Expected socket to still be listening after setting backlog")
+		}
+	})
+}
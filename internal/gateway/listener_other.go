@@ -0,0 +1,15 @@
+//go:build !unix
+
+package gateway
+
+import (
+	"log/slog"
+	"net"
+)
+
+// setListenBacklog is a no-op on platforms without listen(2) backlog tuning;
+// the OS default backlog is used
+func setListenBacklog(listener net.Listener, backlog int) error {
+	slog.Warn("listen_backlog_unsupported", "backlog", backlog, "reason", "not supported on this platform")
+	return nil
+}
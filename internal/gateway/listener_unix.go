@@ -0,0 +1,32 @@
+//go:build unix
+
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setListenBacklog re-issues listen(2) on the bound socket with the given backlog.
+// The kernel may silently cap the value (net.core.somaxconn on Linux,
+// kern.ipc.somaxconn on BSD and macOS).
+func setListenBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("unsupported listener type %T", listener)
+	}
+
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// maxDedupEntries bounds the number of distinct messages tracked before
+// expired entries are swept
+const maxDedupEntries = 256
+
+// logDeduper collapses identical log messages within a window so that a
+// sustained failure produces one line per window instead of one per request
+type logDeduper struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*dedupEntry
+}
+
+// dedupEntry tracks the current window for a single message key
+type dedupEntry struct {
+	windowStart time.Time
+	suppressed  int
+}
+
+// newLogDeduper creates a deduper with the given window; a zero window disables deduplication
+func newLogDeduper(window time.Duration) *logDeduper {
+	return &logDeduper{
+		window:  window,
+		entries: make(map[string]*dedupEntry),
+	}
+}
+
+// Allow reports whether a message with the given key should be logged now, and
+// if so how many identical messages were suppressed during the previous window
+func (d *logDeduper) Allow(key string) (allowed bool, suppressed int) {
+	if d == nil || d.window <= 0 {
+		return true, 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	entry, exists := d.entries[key]
+	if exists && now.Sub(entry.windowStart) < d.window {
+		entry.suppressed++
+		return false, 0
+	}
+
+	if exists {
+		suppressed = entry.suppressed
+	} else if len(d.entries) >= maxDedupEntries {
+		d.sweep(now)
+	}
+
+	d.entries[key] = &dedupEntry{windowStart: now}
+	return true, suppressed
+}
+
+// sweep removes entries whose window has elapsed
+func (d *logDeduper) sweep(now time.Time) {
+	for key, entry := range d.entries {
+		if now.Sub(entry.windowStart) >= d.window {
+			delete(d.entries, key)
+		}
+	}
+}
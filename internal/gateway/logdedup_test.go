@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogDeduper(t *testing.T) {
+	t.Run("Zero window allows every message", func(t *testing.T) {
+		d := newLogDeduper(0)
+		for i := 0; i < 3; i++ {
+			allowed, suppressed := d.Allow("key")
+			if !allowed || suppressed != 0 {
+				t.Errorf("Expected message %d to be allowed with no suppression, got allowed=%v suppressed=%d", i, allowed, suppressed)
+			}
+		}
+	})
+
+	t.Run("Nil deduper allows every message", func(t *testing.T) {
+		var d *logDeduper
+		allowed, _ := d.Allow("key")
+		if !allowed {
+			t.Error("Expected nil deduper to allow message")
+		}
+	})
+
+	t.Run("Identical messages are suppressed within window", func(t *testing.T) {
+		d := newLogDeduper(100 * time.Millisecond)
+
+		if allowed, _ := d.Allow("key"); !allowed {
+			t.Fatal("Expected first message to be allowed")
+		}
+		for i := 0; i < 3; i++ {
+			if allowed, _ := d.Allow("key"); allowed {
+				t.Errorf("Expected repeated message %d to be suppressed", i)
+			}
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		allowed, suppressed := d.Allow("key")
+		if !allowed {
+			t.Error("Expected message to be allowed after window elapsed")
+		}
+		if suppressed != 3 {
+			t.Errorf("Expected 3 suppressed messages, got %d", suppressed)
+		}
+	})
+
+	t.Run("Distinct messages are tracked separately", func(t *testing.T) {
+		d := newLogDeduper(time.Minute)
+
+		if allowed, _ := d.Allow("key1"); !allowed {
+			t.Error("Expected key1 to be allowed")
+		}
+		if allowed, _ := d.Allow("key2"); !allowed {
+			t.Error("Expected key2 to be allowed")
+		}
+		if allowed, _ := d.Allow("key1"); allowed {
+			t.Error("Expected repeated key1 to be suppressed")
+		}
+	})
+}
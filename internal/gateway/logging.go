@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ConfigureLogging installs the default slog logger in the configured format and level.
+// Installing it also routes any remaining standard log package output through the same
+// handler at info level.
+func ConfigureLogging(config *Config) {
+	options := &slog.HandlerOptions{Level: parseLogLevel(config.LogLevel)}
+
+	var handler slog.Handler
+	if config.LogFormat == LogFormatJSON {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// parseLogLevel maps a LOG_LEVEL value to a slog level, defaulting to info
+func parseLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// durationMillis returns d in fractional milliseconds, for duration_ms log attributes
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(os.Stderr)
+	})
+
+	ConfigureLogging(&Config{LogFormat: LogFormatJSON, LogLevel: "error"})
+	if slog.Default().Enabled(t.Context(), slog.LevelWarn) {
+		t.Error("Expected warnings to be disabled at error level")
+	}
+	if !slog.Default().Enabled(t.Context(), slog.LevelError) {
+		t.Error("Expected errors to be enabled at error level")
+	}
+
+	if got := durationMillis(1500 * time.Microsecond); got != 1.5 {
+		t.Errorf("Expected 1.5ms, got %v", got)
+	}
+}
+
+func TestJSONEventAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	app := &App{
+		config:         &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen},
+		cache:          NewCache(60 * time.Second),
+		upstreamClient: client,
+	}
+	app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON log line, got %q", line)
+		}
+		if record["msg"] != "upstream_error" {
+			continue
+		}
+		if host := strings.TrimPrefix(client.baseURL, "http://"); record["upstream_host"] != host {
+			t.Errorf("Expected top-level upstream_host %s, got %v", host, record)
+		}
+		if record["path"] != "/openid/v1/jwks" || record["level"] != "WARN" {
+			t.Errorf("Unexpected upstream_error record %v", record)
+		}
+		return
+	}
+	t.Errorf("Expected an upstream_error record, got %s", buf.String())
+}
@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes every Prometheus metric name
+const metricsNamespace = "kube_oidc_gateway"
+
+// promMetrics holds the Prometheus collectors exposed on /metrics. A nil value
+// records nothing, so handlers can record unconditionally.
+type promMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	cacheHits       *prometheus.CounterVec
+	cacheMisses     *prometheus.CounterVec
+	upstreamLatency *prometheus.HistogramVec
+	upstreamErrors  *prometheus.CounterVec
+	staleServed     *prometheus.CounterVec
+}
+
+// newPromMetrics creates the gateway collectors in a dedicated registry, together
+// with the standard Go runtime and process collectors. cacheAges is called at scrape
+// time to report the age of each cached document.
+func newPromMetrics(cacheAges func() map[string]time.Duration) *promMetrics {
+	m := &promMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "OIDC requests handled, by path and response status.",
+		}, []string{"path", "status"}),
+		cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_hits_total",
+			Help:      "OIDC requests served from a fresh cache entry.",
+		}, []string{"path"}),
+		cacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_misses_total",
+			Help:      "OIDC requests without a fresh cache entry.",
+		}, []string{"path"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_fetch_duration_seconds",
+			Help:      "Latency of upstream fetches made for OIDC requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"path"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_errors_total",
+			Help:      "Failed or invalid upstream fetches made for OIDC requests.",
+		}, []string{"path"}),
+		staleServed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "stale_served_total",
+			Help:      "OIDC requests served from an expired cache entry.",
+		}, []string{"path"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.cacheHits, m.cacheMisses, m.upstreamLatency, m.upstreamErrors, m.staleServed,
+		newCacheAgeCollector(cacheAges),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// cacheAgeCollector reports the age of each cached document as a gauge computed at
+// scrape time, so that the value is never older than the scrape itself
+type cacheAgeCollector struct {
+	desc *prometheus.Desc
+	ages func() map[string]time.Duration
+}
+
+// newCacheAgeCollector creates a collector reporting the ages returned by ages, by path
+func newCacheAgeCollector(ages func() map[string]time.Duration) *cacheAgeCollector {
+	return &cacheAgeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "cache_entry_age_seconds"),
+			"Age of the cached OIDC document, expired or not, since it was fetched.",
+			[]string{"path"}, nil,
+		),
+		ages: ages,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *cacheAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *cacheAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	for path, age := range c.ages() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, age.Seconds(), path)
+	}
+}
+
+// cacheAges returns the age of each cached OIDC document, expired or not, keyed by path.
+// All entries are read from one snapshot taken under the cache's read lock.
+func (a *App) cacheAges() map[string]time.Duration {
+	snapshot := a.cache.Snapshot()
+	now := time.Now()
+
+	ages := make(map[string]time.Duration)
+	for _, path := range a.oidcPaths() {
+		if entry, found := snapshot[a.cacheKey(path)]; found {
+			ages[path] = max(now.Sub(entry.CreatedAt), 0)
+		}
+	}
+	return ages
+}
+
+// observeRequest counts a handled request by path and status
+func (m *promMetrics) observeRequest(path string, status int) {
+	if m != nil {
+		m.requests.WithLabelValues(path, strconv.Itoa(status)).Inc()
+	}
+}
+
+// observeCache counts a cache hit or miss for path
+func (m *promMetrics) observeCache(path string, hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.cacheHits.WithLabelValues(path).Inc()
+	} else {
+		m.cacheMisses.WithLabelValues(path).Inc()
+	}
+}
+
+// observeUpstreamLatency records the duration of an upstream fetch for path
+func (m *promMetrics) observeUpstreamLatency(path string, d time.Duration) {
+	if m != nil {
+		m.upstreamLatency.WithLabelValues(path).Observe(d.Seconds())
+	}
+}
+
+// observeUpstreamError counts a failed or invalid upstream fetch for path
+func (m *promMetrics) observeUpstreamError(path string) {
+	if m != nil {
+		m.upstreamErrors.WithLabelValues(path).Inc()
+	}
+}
+
+// observeStaleServed counts a response served from an expired entry for path
+func (m *promMetrics) observeStaleServed(path string) {
+	if m != nil {
+		m.staleServed.WithLabelValues(path).Inc()
+	}
+}
+
+// HandleMetrics handles the /metrics endpoint in the Prometheus exposition format
+func (a *App) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	if a.metrics == nil {
+		a.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
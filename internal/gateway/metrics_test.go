@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Run("Handlers record requests, cache and upstream metrics", func(t *testing.T) {
+		app := &App{
+			config:         &Config{CacheTTLSeconds: 60, MetricsEnabled: true},
+			cache:          NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+		app.metrics = newPromMetrics(app.cacheAges)
+		captureLogs(t)
+
+		for i := 0; i < 2; i++ {
+			app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		body := w.Body.String()
+		for _, expected := range []string{
+			`kube_oidc_gateway_requests_total{path="/openid/v1/jwks",status="200"} 2`,
+			`kube_oidc_gateway_cache_hits_total{path="/openid/v1/jwks"} 1`,
+			`kube_oidc_gateway_cache_misses_total{path="/openid/v1/jwks"} 1`,
+			`kube_oidc_gateway_upstream_fetch_duration_seconds_count{path="/openid/v1/jwks"} 1`,
+			"go_goroutines",
+		} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected metrics to contain %q", expected)
+			}
+		}
+	})
+
+	t.Run("Upstream errors and stale responses are counted", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, FailMode: FailModeOpen},
+			cache:  NewCache(-time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}),
+		}
+		app.metrics = newPromMetrics(app.cacheAges)
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"stale"`)
+		captureLogs(t)
+
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		w := httptest.NewRecorder()
+		app.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, expected := range []string{
+			`kube_oidc_gateway_upstream_errors_total{path="/openid/v1/jwks"} 1`,
+			`kube_oidc_gateway_stale_served_total{path="/openid/v1/jwks"} 1`,
+		} {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("Expected metrics to contain %q", expected)
+			}
+		}
+	})
+
+	t.Run("Cache entry ages are reported per path at scrape time", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+		}
+		app.metrics = newPromMetrics(app.cacheAges)
+		app.cache.SetAt("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`, time.Now().Add(-90*time.Second), "")
+
+		w := httptest.NewRecorder()
+		app.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		if !strings.Contains(body, `kube_oidc_gateway_cache_entry_age_seconds{path="/openid/v1/jwks"} 90`) {
+			t.Errorf("Expected a 90 second JWKS age, got %s", body)
+		}
+		if strings.Contains(body, `cache_entry_age_seconds{path="/.well-known/openid-configuration"}`) {
+			t.Error("Expected no age for the uncached discovery document")
+		}
+	})
+
+	t.Run("Disabled metrics record nothing and are not found", func(t *testing.T) {
+		app := &App{config: &Config{}}
+		var metrics *promMetrics
+		metrics.observeRequest("/openid/v1/jwks", http.StatusOK)
+		metrics.observeCache("/openid/v1/jwks", true)
+
+		w := httptest.NewRecorder()
+		app.HandleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
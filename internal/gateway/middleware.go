@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// LimitURLLength wraps a handler so that requests whose URL exceeds the configured
+// maximum length are rejected with 414 before reaching any endpoint
+func (a *App) LimitURLLength(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxLength := a.config.MaxURLLength
+		if length := len(r.URL.RequestURI()); maxLength > 0 && length > maxLength {
+			if allowed, suppressed := a.errorLogs.Allow("url_too_long|" + r.RemoteAddr); allowed {
+				attrs := []any{"remote", r.RemoteAddr, "length", length, "max", maxLength}
+				if suppressed > 0 {
+					attrs = append(attrs, "repeated", suppressed)
+				}
+				slog.Warn("url_too_long", attrs...)
+			}
+			a.writeError(w, http.StatusRequestURITooLong, "URI Too Long")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RejectTraceConnect wraps a handler so that TRACE and CONNECT, commonly sent by security
+// scanners, are answered with 405 and an Allow header on every path, including unknown ones.
+// TRACE is never echoed, ruling out cross-site tracing.
+func (a *App) RejectTraceConnect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodTrace && r.Method != http.MethodConnect {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed, suppressed := a.errorLogs.Allow("method_rejected|" + r.Method + "|" + r.RemoteAddr); allowed {
+			attrs := []any{"method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr}
+			if suppressed > 0 {
+				attrs = append(attrs, "repeated", suppressed)
+			}
+			slog.Warn("method_rejected", attrs...)
+		}
+		a.allowMethods(w, r, endpointMethods(r.URL.Path)...)
+	})
+}
+
+// endpointMethods returns the methods served on path: health endpoints also answer HEAD
+func endpointMethods(path string) []string {
+	if path == "/healthz" || path == "/readyz" {
+		return []string{http.MethodGet, http.MethodHead}
+	}
+	return []string{http.MethodGet}
+}
+
+// WarnDeprecatedPaths wraps a handler so that requests to configured deprecated paths
+// carry a Warning header and are logged, while still being served normally
+func (a *App) WarnDeprecatedPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(a.config.DeprecatedPaths, r.URL.Path) {
+			slog.Info("deprecated_path", "path", r.URL.Path, "remote", r.RemoteAddr, "user_agent", r.UserAgent())
+			w.Header().Add("Warning", `299 - "Deprecated path, migrate to a supported endpoint"`)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RestrictHosts wraps a handler so that requests whose Host header is not in the configured
+// allow list are rejected with 421. Health and metrics endpoints are exempt so that probes
+// and Prometheus scrapes addressed by pod IP keep working.
+func (a *App) RestrictHosts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.config.AllowedHosts) == 0 || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" ||
+			r.URL.Path == "/metrics" || hostAllowed(r.Host, a.config.AllowedHosts) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed, suppressed := a.errorLogs.Allow("host_rejected|" + r.Host); allowed {
+			attrs := []any{"host", r.Host, "path", r.URL.Path, "remote", r.RemoteAddr}
+			if suppressed > 0 {
+				attrs = append(attrs, "repeated", suppressed)
+			}
+			slog.Warn("host_rejected", attrs...)
+		}
+		a.writeError(w, http.StatusMisdirectedRequest, "Misdirected Request")
+	})
+}
+
+// hostAllowed reports whether a Host header matches an allowed host, either exactly or
+// by hostname alone when the allowed entry has no port
+func hostAllowed(host string, allowed []string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	for _, candidate := range allowed {
+		if strings.EqualFold(candidate, host) || strings.EqualFold(candidate, hostname) {
+			return true
+		}
+	}
+	return false
+}
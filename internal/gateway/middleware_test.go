@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitURLLength(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		maxLength      int
+		target         string
+		expectedStatus int
+	}{
+		{"Short path is allowed", 64, "/openid/v1/jwks", http.StatusOK},
+		{"Oversized path is rejected", 64, "/" + strings.Repeat("a", 100), http.StatusRequestURITooLong},
+		{"Oversized query is rejected", 64, "/healthz?" + strings.Repeat("q", 100), http.StatusRequestURITooLong},
+		{"Zero disables the limit", 0, "/" + strings.Repeat("a", 100), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{config: &Config{MaxURLLength: tt.maxLength}}
+			buf := captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "203.0.113.7:4242"
+			w := httptest.NewRecorder()
+
+			app.LimitURLLength(next).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusRequestURITooLong && !strings.Contains(buf.String(), "remote=203.0.113.7:4242") {
+				t.Errorf("Expected offender address to be logged, got %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestWarnDeprecatedPaths(t *testing.T) {
+	app := &App{config: &Config{DeprecatedPaths: []string{"/openid/v1/jwks"}}}
+	handler := app.WarnDeprecatedPaths(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("Deprecated path is served with a warning", func(t *testing.T) {
+		buf := captureLogs(t)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if !strings.HasPrefix(w.Header().Get("Warning"), "299 - ") {
+			t.Errorf("Expected 299 Warning header, got %q", w.Header().Get("Warning"))
+		}
+		if !strings.Contains(buf.String(), "deprecated_path path=/openid/v1/jwks") {
+			t.Errorf("Expected deprecated_path log, got %s", buf.String())
+		}
+	})
+
+	t.Run("Other paths are untouched", func(t *testing.T) {
+		buf := captureLogs(t)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+		if w.Header().Get("Warning") != "" {
+			t.Errorf("Expected no Warning header, got %q", w.Header().Get("Warning"))
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Expected no log, got %s", buf.String())
+		}
+	})
+}
+
+func TestRestrictHosts(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		allowedHosts   []string
+		host           string
+		path           string
+		expectedStatus int
+	}{
+		{"Empty list allows all", nil, "evil.example.com", "/openid/v1/jwks", http.StatusOK},
+		{"Matching host", []string{"oidc.example.com"}, "oidc.example.com", "/openid/v1/jwks", http.StatusOK},
+		{"Matching hostname with port", []string{"oidc.example.com"}, "oidc.example.com:8080", "/openid/v1/jwks", http.StatusOK},
+		{"Matching is case-insensitive", []string{"OIDC.example.com"}, "oidc.EXAMPLE.com", "/openid/v1/jwks", http.StatusOK},
+		{"Port must match when configured", []string{"oidc.example.com:443"}, "oidc.example.com:8080", "/openid/v1/jwks", http.StatusMisdirectedRequest},
+		{"Non-matching host", []string{"oidc.example.com"}, "evil.example.com", "/openid/v1/jwks", http.StatusMisdirectedRequest},
+		{"Health endpoints are exempt", []string{"oidc.example.com"}, "10.0.0.5:8080", "/readyz", http.StatusOK},
+		{"Metrics endpoint is exempt", []string{"oidc.example.com"}, "10.0.0.5:8080", "/metrics", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{config: &Config{AllowedHosts: tt.allowedHosts}}
+			buf := captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			app.RestrictHosts(next).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if rejected := strings.Contains(buf.String(), "host_rejected"); rejected != (tt.expectedStatus == http.StatusMisdirectedRequest) {
+				t.Errorf("Unexpected host_rejected log state %v: %s", rejected, buf.String())
+			}
+		})
+	}
+}
+
+func TestRejectTraceConnect(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		method        string
+		path          string
+		expectedAllow string
+	}{
+		{http.MethodTrace, "/openid/v1/jwks", "GET"},
+		{http.MethodConnect, "/.well-known/openid-configuration", "GET"},
+		{http.MethodTrace, "/healthz", "GET, HEAD"},
+		{http.MethodConnect, "/readyz", "GET, HEAD"},
+		{http.MethodTrace, "/unknown", "GET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			app := &App{config: &Config{}}
+			buf := captureLogs(t)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("secret-body"))
+			req.Header.Set("Cookie", "session=secret")
+			w := httptest.NewRecorder()
+
+			app.RejectTraceConnect(next).ServeHTTP(w, req)
+
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status 405, got %d", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+			}
+			if strings.Contains(w.Body.String(), "secret") {
+				t.Errorf("Expected the request not to be echoed, got %s", w.Body.String())
+			}
+			if !strings.Contains(buf.String(), "method_rejected method="+tt.method) {
+				t.Errorf("Expected rejection log, got %s", buf.String())
+			}
+		})
+	}
+
+	t.Run("Other methods pass through", func(t *testing.T) {
+		app := &App{config: &Config{}}
+		w := httptest.NewRecorder()
+		app.RejectTraceConnect(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	})
+}
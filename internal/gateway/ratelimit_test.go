@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("Burst is available immediately", func(t *testing.T) {
+		bucket := newTokenBucket(1, 3)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := bucket.Wait(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("Expected burst to be immediate, took %v", elapsed)
+		}
+	})
+
+	t.Run("Requests beyond burst are held to the QPS cap", func(t *testing.T) {
+		bucket := newTokenBucket(20, 1)
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if err := bucket.Wait(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// One immediate token then four more at 50ms intervals
+		if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+			t.Errorf("Expected at least 200ms for 5 requests at 20 QPS, took %v", elapsed)
+		}
+	})
+
+	t.Run("Wait respects context cancellation", func(t *testing.T) {
+		bucket := newTokenBucket(0.1, 1)
+		bucket.Wait(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if err := bucket.Wait(ctx); err == nil {
+			t.Error("Expected error when context expires before a token is available")
+		}
+	})
+}
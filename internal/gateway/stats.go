@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// requestStats holds concurrency-safe counters describing cache effectiveness
+type requestStats struct {
+	requests       atomic.Uint64
+	hits           atomic.Uint64
+	misses         atomic.Uint64
+	upstreamErrors atomic.Uint64
+	staleServed    atomic.Uint64
+}
+
+// statsSnapshot is a point-in-time copy of the request counters
+type statsSnapshot struct {
+	Requests       uint64 `json:"requests"`
+	Hits           uint64 `json:"hits"`
+	Misses         uint64 `json:"misses"`
+	UpstreamErrors uint64 `json:"upstream_errors"`
+	StaleServed    uint64 `json:"stale_served"`
+}
+
+// snapshot returns the current counter values
+func (s *requestStats) snapshot() statsSnapshot {
+	return statsSnapshot{
+		Requests:       s.requests.Load(),
+		Hits:           s.hits.Load(),
+		Misses:         s.misses.Load(),
+		UpstreamErrors: s.upstreamErrors.Load(),
+		StaleServed:    s.staleServed.Load(),
+	}
+}
+
+// HitRatio returns the fraction of cache lookups that were hits
+func (s statsSnapshot) HitRatio() float64 {
+	lookups := s.Hits + s.Misses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(lookups)
+}
+
+// InFlightRequests returns the number of OIDC requests currently being served
+func (a *App) InFlightRequests() int64 {
+	return a.inFlight.Load()
+}
+
+// StartStatsLogger periodically logs a cache effectiveness summary until the context is cancelled.
+// It does nothing when the stats log interval is not configured.
+func (a *App) StartStatsLogger(ctx context.Context) {
+	interval := a.config.GetStatsLogInterval()
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.logStats()
+			}
+		}
+	}()
+}
+
+// logStats logs a single cache effectiveness summary
+func (a *App) logStats() {
+	s := a.stats.snapshot()
+	slog.Info("cache_stats", "requests", s.Requests, "hits", s.Hits, "misses", s.Misses,
+		"hit_ratio", math.Round(s.HitRatio()*10000)/10000, "upstream_errors", s.UpstreamErrors, "stale_served", s.StaleServed)
+}
+
+// HandleStats handles the /stats endpoint
+// Returns the request counters as JSON for deployments without a metrics stack
+func (a *App) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	response, err := json.MarshalIndent(a.stats.snapshot(), "", "  ")
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestStats(t *testing.T) {
+	t.Run("Hit ratio with no lookups is zero", func(t *testing.T) {
+		var stats requestStats
+		if ratio := stats.snapshot().HitRatio(); ratio != 0 {
+			t.Errorf("Expected hit ratio 0, got %v", ratio)
+		}
+	})
+
+	t.Run("Hit ratio reflects hits and misses", func(t *testing.T) {
+		var stats requestStats
+		stats.requests.Add(4)
+		stats.hits.Add(3)
+		stats.misses.Add(1)
+
+		s := stats.snapshot()
+		if s.Requests != 4 || s.Hits != 3 || s.Misses != 1 {
+			t.Errorf("Unexpected snapshot %+v", s)
+		}
+		if ratio := s.HitRatio(); ratio != 0.75 {
+			t.Errorf("Expected hit ratio 0.75, got %v", ratio)
+		}
+	})
+
+	t.Run("logStats writes a summary line", func(t *testing.T) {
+		app := &App{config: &Config{}}
+		app.stats.requests.Add(2)
+		app.stats.hits.Add(1)
+		app.stats.misses.Add(1)
+
+		buf := captureLogs(t)
+
+		app.logStats()
+
+		line := buf.String()
+		if !strings.Contains(line, "cache_stats requests=2 hits=1 misses=1 hit_ratio=0.5 ") {
+			t.Errorf("Unexpected stats log line: %s", line)
+		}
+	})
+}
+
+func TestInFlightRequests(t *testing.T) {
+	t.Run("Counts requests until they complete", func(t *testing.T) {
+		release := make(chan struct{})
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				<-release
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			req := httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil)
+			app.HandleJWKS(httptest.NewRecorder(), req)
+		}()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for app.InFlightRequests() != 1 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := app.InFlightRequests(); n != 1 {
+			t.Fatalf("Expected 1 in-flight request, got %d", n)
+		}
+
+		close(release)
+		<-done
+
+		if n := app.InFlightRequests(); n != 0 {
+			t.Errorf("Expected 0 in-flight requests after completion, got %d", n)
+		}
+	})
+}
+
+func TestHandleStats(t *testing.T) {
+	t.Run("Counters reflect hits, misses, errors and stale serves", func(t *testing.T) {
+		var failing atomic.Bool
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		get := func() {
+			app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+		}
+		get() // miss, fetched
+		get() // hit
+
+		// Expire the entry and fail upstream so the stale copy is served
+		failing.Store(true)
+		app.cache.entries["/openid/v1/jwks"].ExpiresAt = time.Now().Add(-time.Second)
+		get()
+
+		w := httptest.NewRecorder()
+		app.HandleStats(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var s statsSnapshot
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatalf("Failed to decode stats: %v", err)
+		}
+		expected := statsSnapshot{Requests: 3, Hits: 1, Misses: 2, UpstreamErrors: 1, StaleServed: 1}
+		if s != expected {
+			t.Errorf("Expected %+v, got %+v", expected, s)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdQueueSize bounds the number of metrics waiting to be sent; further metrics are dropped.
+// When batching, it also bounds the timer samples kept per timer between flushes.
+const statsdQueueSize = 1024
+
+// statsdMaxPacketSize keeps batched packets within a typical Ethernet MTU so they are not fragmented
+const statsdMaxPacketSize = 1432
+
+// statsdClient pushes counters and timers to a StatsD endpoint over UDP. Metrics are
+// queued and sent from a background goroutine so request handling never blocks on it,
+// or, when batching, aggregated in memory until the next Flush. A nil client discards
+// all metrics.
+type statsdClient struct {
+	conn     net.Conn
+	prefix   string
+	queue    chan string
+	batching bool
+
+	mu       sync.Mutex
+	counters map[string]int64
+	timers   map[string][]int64
+}
+
+// newStatsdClient creates a StatsD client sending to addr, prefixing every metric name.
+// A batching client only sends metrics when flushed.
+func newStatsdClient(addr, prefix string, batching bool) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve StatsD address %q: %w", addr, err)
+	}
+
+	if prefix != "" {
+		prefix += "."
+	}
+
+	c := &statsdClient{
+		conn:     conn,
+		prefix:   prefix,
+		batching: batching,
+		counters: make(map[string]int64),
+		timers:   make(map[string][]int64),
+	}
+	if !batching {
+		c.queue = make(chan string, statsdQueueSize)
+		go c.run()
+	}
+
+	return c, nil
+}
+
+// run sends queued metrics until the queue is closed
+func (c *statsdClient) run() {
+	for metric := range c.queue {
+		c.write(metric)
+	}
+}
+
+// write sends a single packet
+func (c *statsdClient) write(packet string) {
+	// UDP delivery is best effort; a missing collector must not affect serving
+	if _, err := c.conn.Write([]byte(packet)); err != nil {
+		slog.Warn("statsd_error", "error", err)
+	}
+}
+
+// Increment adds one to the named counter
+func (c *statsdClient) Increment(name string) {
+	if c != nil && c.batching {
+		c.mu.Lock()
+		c.counters[name]++
+		c.mu.Unlock()
+		return
+	}
+	c.send(name, "1|c")
+}
+
+// Timing records a duration in milliseconds for the named timer
+func (c *statsdClient) Timing(name string, d time.Duration) {
+	if c != nil && c.batching {
+		c.mu.Lock()
+		if len(c.timers[name]) < statsdQueueSize {
+			c.timers[name] = append(c.timers[name], d.Milliseconds())
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()))
+}
+
+// send queues a metric without blocking, dropping it when the queue is full
+func (c *statsdClient) send(name, value string) {
+	if c == nil {
+		return
+	}
+
+	select {
+	case c.queue <- c.prefix + name + ":" + value:
+	default:
+	}
+}
+
+// Flush sends the metrics aggregated since the last flush, packing as many as fit into
+// each packet. It does nothing for a nil or non-batching client.
+func (c *statsdClient) Flush() {
+	if c == nil || !c.batching {
+		return
+	}
+
+	c.mu.Lock()
+	counters, timers := c.counters, c.timers
+	c.counters = make(map[string]int64)
+	c.timers = make(map[string][]int64)
+	c.mu.Unlock()
+
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(counters)) {
+		lines = append(lines, fmt.Sprintf("%s%s:%d|c", c.prefix, name, counters[name]))
+	}
+	for _, name := range slices.Sorted(maps.Keys(timers)) {
+		for _, ms := range timers[name] {
+			lines = append(lines, fmt.Sprintf("%s%s:%d|ms", c.prefix, name, ms))
+		}
+	}
+
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			c.write(packet.String())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		c.write(packet.String())
+	}
+}
+
+// StartMetricsFlusher periodically flushes batched StatsD metrics until ctx is done.
+// The final flush on shutdown is made by FlushMetrics.
+func (a *App) StartMetricsFlusher(ctx context.Context) {
+	interval := a.config.GetStatsDFlushInterval()
+	if a.statsd == nil || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.statsd.Flush()
+			}
+		}
+	}()
+}
+
+// FlushMetrics sends any batched metrics immediately, so that none are lost on shutdown
+func (a *App) FlushMetrics() {
+	a.statsd.Flush()
+}
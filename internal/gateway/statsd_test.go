@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenStatsd starts a UDP listener and returns its address and a function reading the next n metrics
+func listenStatsd(t *testing.T) (string, func(n int) []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	read := func(n int) []string {
+		metrics := []string{}
+		buf := make([]byte, 2048)
+		for len(metrics) < n {
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			size, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("Expected %d metrics, got %v: %v", n, metrics, err)
+			}
+			metrics = append(metrics, string(buf[:size]))
+		}
+		return metrics
+	}
+
+	return conn.LocalAddr().String(), read
+}
+
+func TestStatsdClient(t *testing.T) {
+	t.Run("Counters and timers are sent with the prefix", func(t *testing.T) {
+		addr, read := listenStatsd(t)
+		client, err := newStatsdClient(addr, "gw", false)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		client.Increment("cache.hit")
+		client.Timing("upstream.latency", 42*time.Millisecond)
+
+		metrics := read(2)
+		if !slices.Equal(metrics, []string{"gw.cache.hit:1|c", "gw.upstream.latency:42|ms"}) {
+			t.Errorf("Unexpected metrics %v", metrics)
+		}
+	})
+
+	t.Run("Batching aggregates until flushed", func(t *testing.T) {
+		addr, read := listenStatsd(t)
+		client, err := newStatsdClient(addr, "gw", true)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			client.Increment("requests")
+		}
+		client.Increment("cache.hit")
+		client.Timing("upstream.latency", 5*time.Millisecond)
+		client.Timing("upstream.latency", 7*time.Millisecond)
+		client.Flush()
+
+		metrics := read(1)
+		expected := "gw.cache.hit:1|c\ngw.requests:3|c\ngw.upstream.latency:5|ms\ngw.upstream.latency:7|ms"
+		if metrics[0] != expected {
+			t.Errorf("Expected one batched packet %q, got %q", expected, metrics[0])
+		}
+
+		// Counters reset after a flush, and an empty flush sends nothing
+		client.Flush()
+		client.Increment("requests")
+		client.Flush()
+		if metrics := read(1); metrics[0] != "gw.requests:1|c" {
+			t.Errorf("Expected counters to reset after flush, got %q", metrics[0])
+		}
+	})
+
+	t.Run("Batched packets stay within the packet size", func(t *testing.T) {
+		addr, read := listenStatsd(t)
+		client, err := newStatsdClient(addr, "", true)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		for i := 0; i < 200; i++ {
+			client.Timing("upstream.latency", time.Duration(i)*time.Millisecond)
+		}
+		client.Flush()
+
+		// 200 samples need several packets, each kept under the size limit
+		packets := 0
+		for samples := 0; samples < 200; packets++ {
+			packet := read(1)[0]
+			if len(packet) > statsdMaxPacketSize {
+				t.Errorf("Expected packets of at most %d bytes, got %d", statsdMaxPacketSize, len(packet))
+			}
+			samples += strings.Count(packet, "|ms")
+		}
+		if packets < 2 {
+			t.Errorf("Expected the samples to be split across packets, got %d", packets)
+		}
+	})
+
+	t.Run("FlushMetrics sends batched metrics on shutdown", func(t *testing.T) {
+		addr, read := listenStatsd(t)
+		client, err := newStatsdClient(addr, "", true)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		app := &App{config: &Config{StatsDFlushIntervalMS: 60000}, statsd: client}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		app.StartMetricsFlusher(ctx)
+		client.Increment("requests")
+		cancel()
+		app.FlushMetrics()
+
+		if metrics := read(1); metrics[0] != "requests:1|c" {
+			t.Errorf("Expected final flush, got %q", metrics[0])
+		}
+	})
+
+	t.Run("Nil client discards metrics", func(t *testing.T) {
+		var client *statsdClient
+		client.Increment("requests")
+		client.Timing("upstream.latency", time.Second)
+		client.Flush()
+	})
+
+	t.Run("Handlers emit cache metrics", func(t *testing.T) {
+		addr, read := listenStatsd(t)
+		client, err := newStatsdClient(addr, "", false)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			statsd: client,
+		}
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`)
+		captureLogs(t)
+
+		app.HandleJWKS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+
+		metrics := read(2)
+		if !slices.Equal(metrics, []string{"requests:1|c", "cache.hit:1|c"}) {
+			t.Errorf("Unexpected metrics %v", metrics)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// statusResponse is the response body of the /status endpoint. It deliberately
+// omits the upstream host, token and error messages.
+type statusResponse struct {
+	Version   string         `json:"version"`
+	CacheOnly bool           `json:"cache_only"`
+	Upstream  upstreamReport `json:"upstream"`
+	Cache     []cacheReport  `json:"cache"`
+}
+
+// upstreamReport describes recent upstream reachability
+type upstreamReport struct {
+	Reachable     bool       `json:"reachable"`
+	LastCheck     *time.Time `json:"last_check,omitempty"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastErrorKind string     `json:"last_error_kind,omitempty"`
+}
+
+// cacheReport describes the freshness of a single cached path
+type cacheReport struct {
+	Path             string     `json:"path"`
+	Cached           bool       `json:"cached"`
+	Fresh            bool       `json:"fresh"`
+	ETag             string     `json:"etag,omitempty"`
+	FetchedAt        *time.Time `json:"fetched_at,omitempty"`
+	AgeSeconds       int        `json:"age_seconds"`
+	ExpiresInSeconds int        `json:"expires_in_seconds"`
+}
+
+// HandleStatus handles the /status endpoint
+// Returns a JSON snapshot of upstream reachability and cache freshness
+func (a *App) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	now := time.Now()
+	status := statusResponse{
+		Version:   a.config.Version,
+		CacheOnly: a.cacheOnly.Load(),
+		Cache:     []cacheReport{},
+	}
+
+	if a.upstreamClient != nil {
+		upstream := a.upstreamClient.Status()
+		status.Upstream.Reachable = !upstream.LastSuccess.IsZero() && upstream.LastErrorKind == ""
+		status.Upstream.LastCheck = optionalTime(upstream.LastAttempt)
+		status.Upstream.LastSuccess = optionalTime(upstream.LastSuccess)
+		status.Upstream.LastErrorKind = upstream.LastErrorKind
+	}
+
+	for _, path := range a.oidcPaths() {
+		report := cacheReport{Path: path}
+		if entry, found := a.cache.GetStaleEntry(a.cacheKey(path)); found {
+			report.Cached = true
+			report.Fresh = now.Before(entry.ExpiresAt)
+			report.ETag = entry.ETag
+			report.FetchedAt = optionalTime(entry.CreatedAt)
+			report.AgeSeconds = max(int(now.Sub(entry.CreatedAt).Seconds()), 0)
+			report.ExpiresInSeconds = max(int(entry.ExpiresAt.Sub(now).Seconds()), 0)
+		}
+		status.Cache = append(status.Cache, report)
+	}
+
+	response, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// optionalTime returns nil for the zero time so it is omitted from JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
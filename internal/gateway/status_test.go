@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleStatus(t *testing.T) {
+	t.Run("Reports upstream and cache state", func(t *testing.T) {
+		app := &App{
+			config:         &Config{CacheTTLSeconds: 60, Version: "v1.2.3"},
+			cache:          NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+		}
+		captureLogs(t)
+		if err := app.populateCache(); err != nil {
+			t.Fatalf("Failed to populate cache: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		app.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var status statusResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if status.Version != "v1.2.3" {
+			t.Errorf("Expected version v1.2.3, got %s", status.Version)
+		}
+		if !status.Upstream.Reachable || status.Upstream.LastSuccess == nil {
+			t.Errorf("Expected upstream reachable with last success, got %+v", status.Upstream)
+		}
+		if len(status.Cache) != 2 {
+			t.Fatalf("Expected 2 cache reports, got %d", len(status.Cache))
+		}
+		for _, report := range status.Cache {
+			if !report.Cached || !report.Fresh || report.ETag == "" {
+				t.Errorf("Expected %s to be cached and fresh, got %+v", report.Path, report)
+			}
+		}
+		if strings.Contains(w.Body.String(), "test-token") || strings.Contains(w.Body.String(), "127.0.0.1") {
+			t.Errorf("Expected token and upstream host to be redacted, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("Reports upstream failure kind", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}),
+		}
+		captureLogs(t)
+		app.populateCache()
+
+		w := httptest.NewRecorder()
+		app.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		var status statusResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if status.Upstream.Reachable {
+			t.Error("Expected upstream to be unreachable")
+		}
+		if status.Upstream.LastErrorKind != "unauthorized" {
+			t.Errorf("Expected last error kind unauthorized, got %s", status.Upstream.LastErrorKind)
+		}
+		if status.Cache[0].Cached {
+			t.Error("Expected nothing cached")
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// processBody validates and applies the configured transformations to an upstream response body
+func (a *App) processBody(path string, body []byte) ([]byte, error) {
+	if path == jwksPath && a.config.MinJWKSKeys > 0 {
+		if err := validateJWKSKeyCount(body, a.config.MinJWKSKeys); err != nil {
+			return nil, err
+		}
+	}
+	if path == jwksPath && a.config.ValidateKeyMaterial {
+		if err := validateJWKSKeyMaterial(body); err != nil {
+			return nil, err
+		}
+	}
+
+	if path == jwksPath && a.config.SortJWKSKeys {
+		sorted, err := sortJWKSKeys(body)
+		if err != nil {
+			return nil, err
+		}
+		body = sorted
+	}
+
+	if path == discoveryPath && a.config.PublicIssuerURL != "" {
+		// Leave an unparseable document alone; the remaining steps decide whether it is served
+		rewritten, err := rewriteIssuer(body, a.config.PublicIssuerURL)
+		if err != nil {
+			slog.Warn("issuer_rewrite_skipped", "path", path, "error", err)
+		} else {
+			body = rewritten
+		}
+	}
+
+	if path == discoveryPath && a.config.PublicBaseURL != "" {
+		rewritten, err := rewriteDiscoveryURLs(body, a.config.UpstreamHost, a.config.PublicBaseURL)
+		if err != nil {
+			slog.Warn("url_rewrite_skipped", "path", path, "error", err)
+		} else {
+			body = rewritten
+		}
+	}
+
+	if path == discoveryPath && a.discoveryTemplate != nil {
+		rendered, err := renderDiscoveryTemplate(a.discoveryTemplate, body)
+		if err != nil {
+			return nil, err
+		}
+		body = rendered
+	}
+
+	if !a.config.PrettyPrintJSON && !a.config.CanonicalizeJSON {
+		return body, nil
+	}
+
+	// Re-marshaling a decoded document always emits object keys in sorted order
+	jsonData, err := decodeJSON(body)
+	if err != nil {
+		// Formatting is cosmetic, so optionally serve the document as received instead of failing
+		if a.config.PrettyPrintFallbackPassthrough {
+			slog.Warn("pretty_print_fallback", "path", path, "error", err, "reason", "serving upstream body unmodified")
+			return body, nil
+		}
+		return nil, fmt.Errorf("failed to parse JSON for %s: %w", path, err)
+	}
+
+	if !a.config.PrettyPrintJSON {
+		canonicalJSON, err := json.Marshal(jsonData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to canonicalize JSON for %s: %w", path, err)
+		}
+		return canonicalJSON, nil
+	}
+
+	prettyJSON, err := json.MarshalIndent(jsonData, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format JSON for %s: %w", path, err)
+	}
+	return prettyJSON, nil
+}
+
+// rewriteIssuer returns the discovery document with its issuer replaced by issuer
+func rewriteIssuer(body []byte, issuer string) ([]byte, error) {
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+
+	doc, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("discovery document is not a JSON object")
+	}
+	doc["issuer"] = issuer
+
+	return json.Marshal(doc)
+}
+
+// rewriteDiscoveryURLs returns the discovery document with every top-level string value
+// under the upstream base URL moved under the public base URL, so that for example jwks_uri
+// points at the gateway. The issuer is left alone since it must match the tokens being
+// verified; PUBLIC_ISSUER_URL replaces it explicitly.
+func rewriteDiscoveryURLs(body []byte, upstream, public string) ([]byte, error) {
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+
+	doc, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("discovery document is not a JSON object")
+	}
+
+	upstream = strings.TrimSuffix(upstream, "/")
+	public = strings.TrimSuffix(public, "/")
+	rewritten := false
+	for field, value := range doc {
+		s, ok := value.(string)
+		if !ok || field == "issuer" {
+			continue
+		}
+		// Match whole host components so https://api.example.com does not match https://api.example.com.evil
+		rest, found := strings.CutPrefix(s, upstream)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "?")) {
+			continue
+		}
+		doc[field] = public + rest
+		rewritten = true
+	}
+
+	// Keep the upstream bytes when nothing matched
+	if !rewritten {
+		return body, nil
+	}
+	return json.Marshal(doc)
+}
+
+// parseDiscoveryTemplate parses a discovery document template. Besides the standard
+// functions, templates can call json to emit any value as JSON.
+func parseDiscoveryTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("discovery").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			encoded, err := json.Marshal(v)
+			return string(encoded), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderDiscoveryTemplate executes the template with the parsed discovery document as
+// data and verifies that the output is itself a JSON document
+func renderDiscoveryTemplate(tmpl *template.Template, body []byte) ([]byte, error) {
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, doc); err != nil {
+		return nil, fmt.Errorf("failed to render discovery template: %w", err)
+	}
+	if _, err := decodeJSON(rendered.Bytes()); err != nil {
+		return nil, fmt.Errorf("discovery template produced invalid JSON: %w", err)
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// decodeJSON parses a single JSON document, keeping numbers as json.Number so
+// that values round-trip exactly when re-marshaled
+func decodeJSON(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var jsonData any
+	if err := decoder.Decode(&jsonData); err != nil {
+		return nil, err
+	}
+
+	// Reject trailing data after the document, matching json.Unmarshal
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after JSON document")
+	}
+
+	return jsonData, nil
+}
+
+// computeETag returns a strong ETag derived from the SHA-256 of the body
+func computeETag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:]) + `"`
+}
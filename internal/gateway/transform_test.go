@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessBody(t *testing.T) {
+	t.Run("Pretty-print preserves large integers exactly", func(t *testing.T) {
+		app := &App{config: &Config{PrettyPrintJSON: true}}
+		body := []byte(`{"issuer":"https://kubernetes.default.svc","iat":12345678901234567890,"ratio":0.1000000000000000055511151231257827}`)
+
+		result, err := app.processBody("/.well-known/openid-configuration", body)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if !strings.Contains(string(result), `"iat": 12345678901234567890`) {
+			t.Errorf("Expected large integer to round-trip exactly, got %s", result)
+		}
+		if !strings.Contains(string(result), `"ratio": 0.1000000000000000055511151231257827`) {
+			t.Errorf("Expected decimal to round-trip exactly, got %s", result)
+		}
+	})
+
+	t.Run("Pass-through when pretty-print disabled", func(t *testing.T) {
+		app := &App{config: &Config{PrettyPrintJSON: false}}
+		body := []byte(`{"b":1,"a":2}`)
+
+		result, err := app.processBody("/openid/v1/jwks", body)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(result) != string(body) {
+			t.Errorf("Expected unchanged body, got %s", result)
+		}
+	})
+
+	t.Run("Canonicalization makes reordered documents identical", func(t *testing.T) {
+		first := []byte(`{"issuer":"https://example.com","jwks_uri":"https://example.com/openid/v1/jwks","nested":{"z":1,"a":2}}`)
+		second := []byte(`{"nested":{"a":2,"z":1},"jwks_uri":"https://example.com/openid/v1/jwks","issuer":"https://example.com"}`)
+
+		for _, pretty := range []bool{false, true} {
+			app := &App{config: &Config{CanonicalizeJSON: true, PrettyPrintJSON: pretty}}
+
+			a, err := app.processBody("/.well-known/openid-configuration", first)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			b, err := app.processBody("/.well-known/openid-configuration", second)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(a) != string(b) {
+				t.Errorf("pretty=%v: expected identical output, got %s and %s", pretty, a, b)
+			}
+			if computeETag(a) != computeETag(b) {
+				t.Errorf("pretty=%v: expected identical ETags", pretty)
+			}
+			if !pretty && string(a) != `{"issuer":"https://example.com","jwks_uri":"https://example.com/openid/v1/jwks","nested":{"a":2,"z":1}}` {
+				t.Errorf("Expected compact sorted output, got %s", a)
+			}
+		}
+	})
+
+	t.Run("Invalid JSON passes through when fallback enabled", func(t *testing.T) {
+		app := &App{config: &Config{PrettyPrintJSON: true, PrettyPrintFallbackPassthrough: true}}
+		body := []byte(`{"issuer":"https://example.com"} trailing`)
+		captureLogs(t)
+
+		result, err := app.processBody("/.well-known/openid-configuration", body)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(result) != string(body) {
+			t.Errorf("Expected raw body, got %s", result)
+		}
+	})
+
+	t.Run("Invalid JSON returns error", func(t *testing.T) {
+		app := &App{config: &Config{PrettyPrintJSON: true}}
+
+		if _, err := app.processBody("/openid/v1/jwks", []byte(`{not json`)); err == nil {
+			t.Error("Expected error for invalid JSON")
+		}
+	})
+
+	t.Run("Trailing data returns error", func(t *testing.T) {
+		app := &App{config: &Config{PrettyPrintJSON: true}}
+
+		if _, err := app.processBody("/openid/v1/jwks", []byte(`{"keys":[]} {"extra":true}`)); err == nil {
+			t.Error("Expected error for trailing data")
+		}
+	})
+}
+
+func TestDiscoveryTemplate(t *testing.T) {
+	upstream := []byte(`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks"}`)
+
+	t.Run("Template renders the cached document", func(t *testing.T) {
+		tmpl, err := parseDiscoveryTemplate(`{"issuer":{{json .issuer}},"jwks_uri":{{json .jwks_uri}},"service_documentation":"https://example.com"}`)
+		if err != nil {
+			t.Fatalf("Expected template to parse, got %v", err)
+		}
+		app := &App{config: &Config{}, discoveryTemplate: tmpl}
+
+		result, err := app.processBody("/.well-known/openid-configuration", upstream)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := `{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks","service_documentation":"https://example.com"}`
+		if string(result) != expected {
+			t.Errorf("Expected %s, got %s", expected, result)
+		}
+
+		jwks, err := app.processBody("/openid/v1/jwks", []byte(`{"keys":[]}`))
+		if err != nil || string(jwks) != `{"keys":[]}` {
+			t.Errorf("Expected JWKS to be unaffected, got %s, %v", jwks, err)
+		}
+	})
+
+	t.Run("Parse errors are reported", func(t *testing.T) {
+		if _, err := parseDiscoveryTemplate(`{{.issuer`); err == nil {
+			t.Error("Expected parse error")
+		}
+		if _, err := NewApp(&Config{DiscoveryTemplate: `{{if}}`}); err == nil || !strings.Contains(err.Error(), "invalid discovery template") {
+			t.Errorf("Expected NewApp to fail fast, got %v", err)
+		}
+	})
+
+	t.Run("Missing fields and non-JSON output are rejected", func(t *testing.T) {
+		for _, text := range []string{`{"x":{{json .missing}}}`, `issuer={{.issuer}}`} {
+			tmpl, err := parseDiscoveryTemplate(text)
+			if err != nil {
+				t.Fatalf("Expected template to parse, got %v", err)
+			}
+			app := &App{config: &Config{}, discoveryTemplate: tmpl}
+			if _, err := app.processBody("/.well-known/openid-configuration", upstream); err == nil {
+				t.Errorf("Expected error rendering %q", text)
+			}
+		}
+	})
+}
+
+func TestPublicIssuerURL(t *testing.T) {
+	app := &App{config: &Config{PublicIssuerURL: "https://oidc.example.com"}}
+
+	t.Run("Issuer is replaced before the ETag is computed", func(t *testing.T) {
+		result, err := app.processBody("/.well-known/openid-configuration", []byte(`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks"}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := `{"issuer":"https://oidc.example.com","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks"}`
+		if string(result) != expected {
+			t.Errorf("Expected %s, got %s", expected, result)
+		}
+
+		jwks, err := app.processBody("/openid/v1/jwks", []byte(`{"keys":[],"issuer":"x"}`))
+		if err != nil || string(jwks) != `{"keys":[],"issuer":"x"}` {
+			t.Errorf("Expected JWKS to be unaffected, got %s, %v", jwks, err)
+		}
+	})
+
+	t.Run("Invalid JSON skips the rewrite", func(t *testing.T) {
+		buf := captureLogs(t)
+		result, err := app.processBody("/.well-known/openid-configuration", []byte(`not json`))
+		if err != nil || string(result) != "not json" {
+			t.Errorf("Expected body to pass through unchanged, got %s, %v", result, err)
+		}
+		if !strings.Contains(buf.String(), "issuer_rewrite_skipped path=/.well-known/openid-configuration") {
+			t.Errorf("Expected skip to be logged, got %s", buf.String())
+		}
+	})
+
+	t.Run("Relative URLs are rejected at startup", func(t *testing.T) {
+		if _, err := NewApp(&Config{PublicIssuerURL: "oidc.example.com"}); err == nil || !strings.Contains(err.Error(), "PUBLIC_ISSUER_URL") {
+			t.Errorf("Expected NewApp to fail, got %v", err)
+		}
+	})
+}
+
+func TestRewriteDiscoveryURLs(t *testing.T) {
+	const upstream = "https://kubernetes.default.svc"
+	const public = "https://gateway.example.com/"
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			"Matching URLs are rewritten and the issuer kept",
+			`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks","token_endpoint":"https://kubernetes.default.svc/token?x=1"}`,
+			`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://gateway.example.com/openid/v1/jwks","token_endpoint":"https://gateway.example.com/token?x=1"}`,
+		},
+		{
+			"Non-matching prefixes are left alone",
+			`{"jwks_uri":"https://kubernetes.default.svc.evil/openid/v1/jwks","authorization_endpoint":"https://other.example.com/auth"}`,
+			`{"jwks_uri":"https://kubernetes.default.svc.evil/openid/v1/jwks","authorization_endpoint":"https://other.example.com/auth"}`,
+		},
+		{
+			"Missing fields and non-string values are ignored",
+			`{"response_types_supported":["id_token"],"count":3}`,
+			`{"response_types_supported":["id_token"],"count":3}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rewriteDiscoveryURLs([]byte(tt.body), upstream, public)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Invalid documents are rejected", func(t *testing.T) {
+		for _, body := range []string{`not json`, `["https://kubernetes.default.svc"]`} {
+			if _, err := rewriteDiscoveryURLs([]byte(body), upstream, public); err == nil {
+				t.Errorf("Expected error for %s", body)
+			}
+		}
+	})
+
+	t.Run("Discovery processing applies PUBLIC_BASE_URL", func(t *testing.T) {
+		app := &App{config: &Config{UpstreamHost: upstream, PublicBaseURL: public}}
+		result, err := app.processBody("/.well-known/openid-configuration", []byte(`{"jwks_uri":"https://kubernetes.default.svc/openid/v1/jwks"}`))
+		if err != nil || string(result) != `{"jwks_uri":"https://gateway.example.com/openid/v1/jwks"}` {
+			t.Errorf("Expected rewritten jwks_uri, got %s, %v", result, err)
+		}
+	})
+}
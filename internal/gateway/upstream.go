@@ -4,10 +4,18 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -20,6 +28,54 @@ type UpstreamClient struct {
 	httpClient *http.Client
 	baseURL    string
 	token      string
+	slots      chan struct{}
+	pathSlots  pathSlots
+	limiter    *tokenBucket
+	headers    http.Header
+	state      upstreamState
+}
+
+// pathSlots holds a concurrency semaphore per upstream path, created on first use,
+// so that one slow path cannot occupy every upstream slot
+type pathSlots struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+// get returns the semaphore for path, or nil when per-path limiting is disabled
+func (p *pathSlots) get(path string) chan struct{} {
+	if p.limit <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.slots == nil {
+		p.slots = make(map[string]chan struct{})
+	}
+	slots, ok := p.slots[path]
+	if !ok {
+		slots = make(chan struct{}, p.limit)
+		p.slots[path] = slots
+	}
+	return slots
+}
+
+// upstreamState records the outcome of the most recent upstream requests
+type upstreamState struct {
+	mu            sync.Mutex
+	lastAttempt   time.Time
+	lastSuccess   time.Time
+	lastErrorKind string
+}
+
+// UpstreamStatus is a snapshot of recent upstream request outcomes
+type UpstreamStatus struct {
+	LastAttempt   time.Time
+	LastSuccess   time.Time
+	LastErrorKind string
 }
 
 // NewUpstreamClient creates a new upstream client configured for in-cluster access
@@ -31,16 +87,10 @@ func NewUpstreamClient(config *Config) (*UpstreamClient, error) {
 	}
 	token := string(tokenBytes)
 
-	// Read the CA certificate
-	caCert, err := os.ReadFile(config.SACACertPath)
+	// Load the CA certificates into a single pool
+	caCertPool, err := loadCACertPool(config.GetCACertPaths())
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	// Create a certificate pool and add the CA
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to parse CA certificate")
+		return nil, err
 	}
 
 	// Create TLS config
@@ -48,57 +98,310 @@ func NewUpstreamClient(config *Config) (*UpstreamClient, error) {
 		RootCAs: caCertPool,
 	}
 
+	// Resume TLS sessions to avoid full handshakes when reconnecting after idle timeouts
+	if config.TLSSessionCacheSize > 0 {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(config.TLSSessionCacheSize)
+		slog.Info("upstream_tls_session_resumption_enabled", "cache_size", config.TLSSessionCacheSize)
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+
+	// Cache the API server's address briefly to spare cluster DNS on every new connection
+	if config.UpstreamDNSCacheTTLSeconds > 0 {
+		transport.DialContext = newDNSCache(config.GetUpstreamDNSCacheTTL()).DialContext
+		slog.Info("upstream_dns_cache_enabled", "ttl_seconds", config.UpstreamDNSCacheTTLSeconds)
+	}
+
+	// Resolve the API server once and keep dialing those addresses, so later DNS failures
+	// cannot break upstream calls. Only the TCP destination changes; TLS still verifies
+	// and sends SNI for the configured host name.
+	if config.PinUpstreamIP {
+		dialContext, err := pinUpstreamHost(config.UpstreamHost)
+		if err != nil {
+			return nil, err
+		}
+		transport.DialContext = dialContext
+	}
+
 	// Create HTTP client with timeout and TLS config
 	httpClient := &http.Client{
-		Timeout: config.GetUpstreamTimeout(),
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+		Timeout:   config.GetUpstreamTimeout(),
+		Transport: transport,
+	}
+
+	headers, err := parseUpstreamHeaders(config.UpstreamHeaders)
+	if err != nil {
+		return nil, err
 	}
 
-	return &UpstreamClient{
+	client := &UpstreamClient{
 		httpClient: httpClient,
 		baseURL:    config.UpstreamHost,
 		token:      token,
+		headers:    headers,
+	}
+
+	// Bound the number of simultaneous requests the API server sees from this gateway
+	if config.UpstreamMaxConcurrency > 0 {
+		client.slots = make(chan struct{}, config.UpstreamMaxConcurrency)
+	}
+
+	// Keep a slow path from starving the others of upstream capacity
+	client.pathSlots.limit = config.UpstreamMaxConcurrencyPerPath
+
+	// Hold the gateway to a hard request rate ceiling against the API server
+	if config.UpstreamQPS > 0 {
+		client.limiter = newTokenBucket(config.UpstreamQPS, config.UpstreamBurst)
+	}
+
+	return client, nil
+}
+
+// loadCACertPool builds a certificate pool from every readable PEM bundle in paths.
+// Unusable files are logged and skipped; it fails only when no file yields a certificate.
+func loadCACertPool(paths []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	loaded := 0
+	for _, path := range paths {
+		caCert, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("ca_certificate_unreadable", "file", path, "error", err)
+			continue
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			slog.Warn("ca_certificate_invalid", "file", path)
+			continue
+		}
+		loaded++
+	}
+
+	if loaded == 0 {
+		return nil, fmt.Errorf("failed to load CA certificate: no usable certificate in %s", strings.Join(paths, ","))
+	}
+	return pool, nil
+}
+
+// acquireSlot waits for a free concurrency slot for path, then for a free global upstream
+// slot, and returns a function releasing both
+func (u *UpstreamClient) acquireSlot(ctx context.Context, path string) (release func(), err error) {
+	releasePath, err := acquire(ctx, u.pathSlots.get(path))
+	if err != nil {
+		return nil, err
+	}
+
+	releaseGlobal, err := acquire(ctx, u.slots)
+	if err != nil {
+		releasePath()
+		return nil, err
+	}
+
+	return func() {
+		releaseGlobal()
+		releasePath()
 	}, nil
 }
 
+// acquire waits for a free slot in a semaphore and returns a function releasing it.
+// A nil semaphore is unlimited.
+func acquire(ctx context.Context, slots chan struct{}) (release func(), err error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for upstream concurrency slot: %w", ctx.Err())
+	}
+}
+
+// UpstreamResponse is a successful upstream response together with the metadata
+// needed to judge its freshness
+type UpstreamResponse struct {
+	Body       []byte
+	Header     http.Header
+	ReceivedAt time.Time
+
+	// NotModified is set when a conditional request was answered with 304; Body is empty
+	NotModified bool
+}
+
+// OriginTime estimates when the upstream generated the response, using the corrected
+// age from its Date and Age headers (RFC 9111 section 4.2.3). Without usable headers
+// it falls back to the local receive time.
+func (r *UpstreamResponse) OriginTime() time.Time {
+	var age time.Duration
+	if date, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+		age = max(r.ReceivedAt.Sub(date), 0)
+	}
+	if seconds, err := strconv.Atoi(r.Header.Get("Age")); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+
+	return r.ReceivedAt.Add(-age)
+}
+
 // Fetch retrieves data from the upstream path with context
 func (u *UpstreamClient) Fetch(ctx context.Context, path string) ([]byte, error) {
+	resp, err := u.FetchResponse(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FetchResponse retrieves data from the upstream path with context, keeping the
+// response headers and receive time
+func (u *UpstreamClient) FetchResponse(ctx context.Context, path string) (*UpstreamResponse, error) {
+	return u.do(ctx, path, "")
+}
+
+// FetchConditional retrieves data from the upstream path, sending etag as If-None-Match
+// when it is not empty. An unchanged document is reported with NotModified rather than
+// downloaded again.
+func (u *UpstreamClient) FetchConditional(ctx context.Context, path, etag string) (*UpstreamResponse, error) {
+	return u.do(ctx, path, etag)
+}
+
+// do sends a GET request to the upstream path and returns the response.
+// A non-empty ifNoneMatch makes the request conditional.
+func (u *UpstreamClient) do(ctx context.Context, path, ifNoneMatch string) (response *UpstreamResponse, err error) {
+	defer func() { u.record(err) }()
+
 	url := u.baseURL + path
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add authorization header with service account token
+	for name, values := range u.headers {
+		req.Header[name] = values
+	}
+	for name, values := range upstreamHeadersFrom(ctx) {
+		req.Header[name] = values
+	}
 	req.Header.Set("Authorization", "Bearer "+u.token)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	removeHopByHopHeaders(req.Header)
+
+	if u.limiter != nil {
+		if err := u.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := u.acquireSlot(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
+		if isTimeout(err) {
+			return nil, fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+		}
 		return nil, fmt.Errorf("upstream request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	removeHopByHopHeaders(resp.Header)
+
+	if ifNoneMatch != "" && resp.StatusCode == http.StatusNotModified {
+		return &UpstreamResponse{Header: resp.Header, ReceivedAt: time.Now(), NotModified: true}, nil
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Limit response size to prevent memory exhaustion
 	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
 	body, err := io.ReadAll(limitedReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrUpstreamBody, err)
 	}
 
-	return body, nil
+	return &UpstreamResponse{Body: body, Header: resp.Header, ReceivedAt: time.Now()}, nil
+}
+
+// pinUpstreamHost resolves the host of upstreamHost and returns a dial function that
+// always connects to the addresses resolved now
+func pinUpstreamHost(upstreamHost string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	parsed, err := url.Parse(upstreamHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream host %q: %w", upstreamHost, err)
+	}
+
+	dns := newDNSCache(0)
+	host := parsed.Hostname()
+	if net.ParseIP(host) != nil {
+		slog.Info("upstream_ip_pinning_skipped", "host", host, "reason", "host is already an IP address")
+		return dns.DialContext, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := dns.pin(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin upstream IP for %s: %w", host, err)
+	}
+
+	slog.Info("upstream_ip_pinned", "host", host, "addrs", strings.Join(addrs, ","))
+	return dns.DialContext, nil
+}
+
+// Host returns the host:port of the API server requests are sent to, for logging
+func (u *UpstreamClient) Host() string {
+	if parsed, err := url.Parse(u.baseURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return u.baseURL
+}
+
+// record stores the outcome of an upstream request
+func (u *UpstreamClient) record(err error) {
+	u.state.mu.Lock()
+	defer u.state.mu.Unlock()
+
+	now := time.Now()
+	u.state.lastAttempt = now
+	if err != nil {
+		u.state.lastErrorKind = upstreamErrorKind(err)
+		return
+	}
+	u.state.lastSuccess = now
+	u.state.lastErrorKind = ""
+}
+
+// Status returns a snapshot of recent upstream request outcomes
+func (u *UpstreamClient) Status() UpstreamStatus {
+	u.state.mu.Lock()
+	defer u.state.mu.Unlock()
+
+	return UpstreamStatus{
+		LastAttempt:   u.state.lastAttempt,
+		LastSuccess:   u.state.lastSuccess,
+		LastErrorKind: u.state.lastErrorKind,
+	}
+}
+
+// isTimeout reports whether err was caused by a deadline or client timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
 }
 
 // HealthCheck performs a basic connectivity check to the upstream
 func (u *UpstreamClient) HealthCheck() error {
 	// Try to fetch the well-known configuration as a health check
 	ctx := context.Background()
-	_, err := u.Fetch(ctx, "/.well-known/openid-configuration")
+	_, err := u.Fetch(ctx, discoveryPath)
 	return err
 }
@@ -0,0 +1,384 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeTestCACert generates a self-signed CA certificate and writes it as PEM to a temporary file
+func writeTestCACert(t *testing.T, commonName string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), commonName+".crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	return path
+}
+
+// writeTestToken writes a service account token to a temporary file
+func writeTestToken(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("test-token"), 0o600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	return path
+}
+
+func TestNewUpstreamClient(t *testing.T) {
+	t.Run("TLS session cache enabled when size configured", func(t *testing.T) {
+		config := &Config{
+			UpstreamHost:        "https://kubernetes.default.svc",
+			SATokenPath:         writeTestToken(t),
+			SACACertPath:        writeTestCACert(t, "test-ca"),
+			TLSSessionCacheSize: 16,
+		}
+
+		client, err := NewUpstreamClient(config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		transport := client.httpClient.Transport.(*http.Transport)
+		if transport.TLSClientConfig.ClientSessionCache == nil {
+			t.Error("Expected TLS client session cache to be configured")
+		}
+	})
+
+	t.Run("TLS session cache disabled when size is zero", func(t *testing.T) {
+		config := &Config{
+			UpstreamHost: "https://kubernetes.default.svc",
+			SATokenPath:  writeTestToken(t),
+			SACACertPath: writeTestCACert(t, "test-ca"),
+		}
+
+		client, err := NewUpstreamClient(config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		transport := client.httpClient.Transport.(*http.Transport)
+		if transport.TLSClientConfig.ClientSessionCache != nil {
+			t.Error("Expected no TLS client session cache")
+		}
+	})
+
+	t.Run("Missing token returns error", func(t *testing.T) {
+		config := &Config{
+			SATokenPath:  filepath.Join(t.TempDir(), "missing"),
+			SACACertPath: writeTestCACert(t, "test-ca"),
+		}
+
+		if _, err := NewUpstreamClient(config); err == nil {
+			t.Error("Expected error for missing token")
+		}
+	})
+
+	t.Run("Multiple CA bundles are trusted together", func(t *testing.T) {
+		first := writeTestCACert(t, "cluster-a")
+		second := writeTestCACert(t, "cluster-b")
+		captureLogs(t)
+		config := &Config{
+			SATokenPath:   writeTestToken(t),
+			SACACertPath:  filepath.Join(t.TempDir(), "ignored"),
+			SACACertPaths: []string{first, filepath.Join(t.TempDir(), "missing"), second},
+		}
+
+		client, err := NewUpstreamClient(config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := x509.NewCertPool()
+		for _, path := range []string{first, second} {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", path, err)
+			}
+			expected.AppendCertsFromPEM(pem)
+		}
+
+		transport := client.httpClient.Transport.(*http.Transport)
+		if !transport.TLSClientConfig.RootCAs.Equal(expected) {
+			t.Error("Expected root CAs to contain both bundles")
+		}
+	})
+
+	t.Run("No usable CA bundle returns error", func(t *testing.T) {
+		captureLogs(t)
+		config := &Config{
+			SATokenPath:   writeTestToken(t),
+			SACACertPaths: []string{filepath.Join(t.TempDir(), "missing"), writeTestToken(t)},
+		}
+
+		if _, err := NewUpstreamClient(config); err == nil {
+			t.Error("Expected error when no CA bundle is usable")
+		}
+	})
+}
+
+func TestUpstreamConcurrency(t *testing.T) {
+	t.Run("Concurrent fetches never exceed the limit", func(t *testing.T) {
+		var inFlight, maxInFlight atomic.Int32
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				observed := maxInFlight.Load()
+				if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		})
+		client.slots = make(chan struct{}, 2)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := client.Fetch(context.Background(), "/openid/v1/jwks"); err != nil {
+					t.Errorf("Unexpected fetch error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if max := maxInFlight.Load(); max > 2 {
+			t.Errorf("Expected at most 2 concurrent upstream requests, observed %d", max)
+		}
+	})
+
+	t.Run("Waiting for a slot respects context cancellation", func(t *testing.T) {
+		client := newTestUpstreamClient(t, oidcUpstreamHandler)
+		client.slots = make(chan struct{}, 1)
+		client.slots <- struct{}{} // occupy the only slot
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if _, err := client.Fetch(ctx, "/openid/v1/jwks"); err == nil {
+			t.Error("Expected error when no slot becomes available before the deadline")
+		}
+	})
+}
+
+func TestUpstreamConcurrencyPerPath(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openid/v1/jwks" {
+			started <- struct{}{}
+			<-release
+		}
+		w.Write([]byte(`{}`))
+	})
+	client.slots = make(chan struct{}, 2)
+	client.pathSlots.limit = 1
+
+	// Hold the only JWKS slot with a slow request
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Fetch(context.Background(), "/openid/v1/jwks")
+		done <- err
+	}()
+	<-started
+
+	t.Run("A busy path waits for its own slot", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := client.Fetch(ctx, "/openid/v1/jwks"); err == nil {
+			t.Error("Expected the second JWKS fetch to time out waiting for a slot")
+		}
+	})
+
+	t.Run("Other paths are unaffected", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := client.Fetch(ctx, "/.well-known/openid-configuration"); err != nil {
+			t.Errorf("Expected discovery fetch to succeed, got %v", err)
+		}
+	})
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error from slow fetch: %v", err)
+	}
+	if len(client.slots) != 0 {
+		t.Errorf("Expected all global slots to be released, %d held", len(client.slots))
+	}
+}
+
+func TestUpstreamRateLimit(t *testing.T) {
+	t.Run("Fetch is held to the configured QPS", func(t *testing.T) {
+		client := newTestUpstreamClient(t, oidcUpstreamHandler)
+		client.limiter = newTokenBucket(20, 1)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if _, err := client.Fetch(context.Background(), "/openid/v1/jwks"); err != nil {
+				t.Fatalf("Unexpected fetch error: %v", err)
+			}
+		}
+
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("Expected at least 100ms for 3 fetches at 20 QPS, took %v", elapsed)
+		}
+	})
+}
+
+func TestUpstreamHealthCheck(t *testing.T) {
+	t.Run("Probes discovery with GET", func(t *testing.T) {
+		var gotMethod, gotPath string
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			gotMethod, gotPath = r.Method, r.URL.Path
+			w.Write([]byte(`{}`))
+		})
+
+		if err := client.HealthCheck(); err != nil {
+			t.Fatalf("Expected health check to pass, got %v", err)
+		}
+		if gotMethod != http.MethodGet || gotPath != discoveryPath {
+			t.Errorf("Expected GET %s, got %s %s", discoveryPath, gotMethod, gotPath)
+		}
+	})
+
+	t.Run("Failing probe returns error", func(t *testing.T) {
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+		if err := client.HealthCheck(); err == nil {
+			t.Error("Expected health check to fail")
+		}
+	})
+}
+
+func TestUpstreamFetchErrors(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(fmt.Sprintf("Status %d is an authorization failure", status), func(t *testing.T) {
+			client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			})
+
+			_, err := client.Fetch(context.Background(), jwksPath)
+			if !errors.Is(err, ErrUpstreamUnauthorized) {
+				t.Errorf("Expected ErrUpstreamUnauthorized, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Server error is not an authorization failure", func(t *testing.T) {
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+		_, err := client.Fetch(context.Background(), jwksPath)
+		if err == nil || errors.Is(err, ErrUpstreamUnauthorized) {
+			t.Errorf("Expected non-authorization error, got %v", err)
+		}
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected StatusError with status 500, got %v", err)
+		}
+	})
+
+	t.Run("Deadline is a timeout", func(t *testing.T) {
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.Fetch(ctx, jwksPath)
+		if !errors.Is(err, ErrUpstreamTimeout) {
+			t.Errorf("Expected ErrUpstreamTimeout, got %v", err)
+		}
+	})
+
+	t.Run("Truncated body is a body error", func(t *testing.T) {
+		client := newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(`{"keys":`))
+		})
+
+		_, err := client.Fetch(context.Background(), jwksPath)
+		if !errors.Is(err, ErrUpstreamBody) {
+			t.Errorf("Expected ErrUpstreamBody, got %v", err)
+		}
+	})
+}
+
+func TestUpstreamResponseOriginTime(t *testing.T) {
+	received := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		date     string
+		age      string
+		expected time.Time
+	}{
+		{"No headers uses receive time", "", "", received},
+		{"Date in the past", received.Add(-10 * time.Second).Format(http.TimeFormat), "", received.Add(-10 * time.Second)},
+		{"Date and Age are combined", received.Add(-10 * time.Second).Format(http.TimeFormat), "20", received.Add(-30 * time.Second)},
+		{"Age alone", "", "5", received.Add(-5 * time.Second)},
+		{"Future Date is ignored", received.Add(time.Minute).Format(http.TimeFormat), "", received},
+		{"Invalid headers are ignored", "yesterday", "-3", received},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.date != "" {
+				header.Set("Date", tt.date)
+			}
+			if tt.age != "" {
+				header.Set("Age", tt.age)
+			}
+			resp := &UpstreamResponse{Header: header, ReceivedAt: received}
+
+			if got := resp.OriginTime(); !got.Equal(tt.expected) {
+				t.Errorf("Expected origin %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// checkJWKSConsistency verifies that the jwks_uri advertised in a discovery
+// document points at the JWKS path this gateway serves
+func checkJWKSConsistency(discovery []byte) error {
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(discovery, &doc); err != nil {
+		return fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+
+	if doc.JWKSURI == "" {
+		return fmt.Errorf("discovery document has no jwks_uri")
+	}
+
+	jwksURL, err := url.Parse(doc.JWKSURI)
+	if err != nil {
+		return fmt.Errorf("invalid jwks_uri %q: %w", doc.JWKSURI, err)
+	}
+
+	if jwksURL.Path != jwksPath {
+		return fmt.Errorf("jwks_uri %q does not match served path %s", doc.JWKSURI, jwksPath)
+	}
+
+	return nil
+}
+
+// validateJWKSKeyCount verifies that a JWKS document contains at least minKeys keys
+func validateJWKSKeyCount(body []byte, minKeys int) error {
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	if len(jwks.Keys) < minKeys {
+		return fmt.Errorf("JWKS has %d keys, at least %d required", len(jwks.Keys), minKeys)
+	}
+
+	return nil
+}
+
+// keyMaterialFields are the JWK members holding base64url-encoded key material (RFC 7518 section 6)
+var keyMaterialFields = []string{"n", "e", "x", "y"}
+
+// validateJWKSKeyMaterial verifies that a JWKS document is internally consistent: key IDs
+// are unique and every key material member present is valid unpadded base64url
+func validateJWKSKeyMaterial(body []byte) error {
+	var jwks struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	seen := make(map[string]bool, len(jwks.Keys))
+	for i, key := range jwks.Keys {
+		if kid, ok := key["kid"].(string); ok && kid != "" {
+			if seen[kid] {
+				return fmt.Errorf("JWKS key %d has duplicate kid %q", i, kid)
+			}
+			seen[kid] = true
+		}
+
+		for _, field := range keyMaterialFields {
+			value, present := key[field]
+			if !present {
+				continue
+			}
+			encoded, ok := value.(string)
+			if !ok || encoded == "" {
+				return fmt.Errorf("JWKS key %d has non-string or empty %q", i, field)
+			}
+			if _, err := base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				return fmt.Errorf("JWKS key %d has invalid base64url %q: %w", i, field, err)
+			}
+		}
+	}
+
+	return nil
+}
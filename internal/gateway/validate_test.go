@@ -0,0 +1,78 @@
+package gateway
+
+import "testing"
+
+func TestCheckJWKSConsistency(t *testing.T) {
+	tests := []struct {
+		name      string
+		discovery string
+		wantErr   bool
+	}{
+		{"Matching path", `{"jwks_uri":"https://gateway.example.com/openid/v1/jwks"}`, false},
+		{"Different host same path", `{"jwks_uri":"https://172.16.0.1:443/openid/v1/jwks"}`, false},
+		{"Mismatched path", `{"jwks_uri":"https://gateway.example.com/keys"}`, true},
+		{"Missing jwks_uri", `{"issuer":"https://gateway.example.com"}`, true},
+		{"Invalid JSON", `{not json`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJWKSConsistency([]byte(tt.discovery))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateJWKSKeyCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		jwks    string
+		minKeys int
+		wantErr bool
+	}{
+		{"Enough keys", `{"keys":[{"kid":"a"},{"kid":"b"}]}`, 2, false},
+		{"Fewer keys than minimum", `{"keys":[{"kid":"a"}]}`, 2, true},
+		{"Empty JWKS", `{"keys":[]}`, 1, true},
+		{"Missing keys member", `{}`, 1, true},
+		{"Invalid JSON", `{not json`, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJWKSKeyCount([]byte(tt.jwks), tt.minKeys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateJWKSKeyMaterial(t *testing.T) {
+	tests := []struct {
+		name    string
+		jwks    string
+		wantErr bool
+	}{
+		{"Valid RSA key", `{"keys":[{"kid":"a","kty":"RSA","n":"0vx7agoebGcQSuuPiLJXZpt","e":"AQAB"}]}`, false},
+		{"Valid EC key", `{"keys":[{"kid":"a","kty":"EC","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}]}`, false},
+		{"Keys without kid", `{"keys":[{"kty":"RSA","e":"AQAB"},{"kty":"RSA","e":"AQAB"}]}`, false},
+		{"Duplicate kid", `{"keys":[{"kid":"a","e":"AQAB"},{"kid":"a","e":"AQAB"}]}`, true},
+		{"Standard base64 characters", `{"keys":[{"kid":"a","n":"ab+/cd","e":"AQAB"}]}`, true},
+		{"Padded base64url", `{"keys":[{"kid":"a","e":"AQAB=="}]}`, true},
+		{"Invalid characters", `{"keys":[{"kid":"a","x":"not base64!"}]}`, true},
+		{"Non-string material", `{"keys":[{"kid":"a","e":65537}]}`, true},
+		{"Empty material", `{"keys":[{"kid":"a","y":""}]}`, true},
+		{"Invalid JSON", `{not json`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJWKSKeyMaterial([]byte(tt.jwks))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
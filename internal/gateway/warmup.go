@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WarmUp populates the cache, retrying with exponential backoff until it succeeds
+// or the context is done
+func (a *App) WarmUp(ctx context.Context) error {
+	start := time.Now()
+	backoff := a.config.GetWarmupBackoffInitial()
+	for attempt := 1; ; attempt++ {
+		err := a.populateCache()
+		if err == nil {
+			slog.Info("cache_warmup", "attempts", attempt, "duration_ms", durationMillis(time.Since(start)))
+			return nil
+		}
+		slog.Warn("cache_warmup_failed", "attempt", attempt, "error", err, "next_retry_ms", durationMillis(backoff))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cache warm-up did not succeed after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = nextBackoff(backoff, a.config.GetWarmupBackoffMax())
+	}
+}
+
+// nextBackoff doubles the delay, capped at maxDelay
+func nextBackoff(delay, maxDelay time.Duration) time.Duration {
+	delay *= 2
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	delay := 100 * time.Millisecond
+	var progression []time.Duration
+	for i := 0; i < 5; i++ {
+		delay = nextBackoff(delay, time.Second)
+		progression = append(progression, delay)
+	}
+
+	expected := []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i := range expected {
+		if progression[i] != expected[i] {
+			t.Errorf("Step %d: expected %v, got %v", i, expected[i], progression[i])
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	t.Run("Retries until the cache is populated", func(t *testing.T) {
+		var calls atomic.Int32
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, WarmupBackoffInitialMS: 10},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := app.WarmUp(ctx); err != nil {
+			t.Fatalf("Expected warm-up to succeed, got %v", err)
+		}
+		for _, path := range []string{"/.well-known/openid-configuration", "/openid/v1/jwks"} {
+			if _, found := app.cache.GetEntry(path); !found {
+				t.Errorf("Expected %s to be cached after warm-up", path)
+			}
+		}
+	})
+
+	t.Run("Fails when the deadline passes", func(t *testing.T) {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}),
+		}
+		captureLogs(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if err := app.WarmUp(ctx); err == nil {
+			t.Error("Expected warm-up to fail")
+		}
+	})
+	t.Run("Only enabled endpoints are warmed", func(t *testing.T) {
+		var requested []string
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, EnabledEndpoints: []string{EndpointJWKS}},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requested = append(requested, r.URL.Path)
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		if err := app.WarmUp(context.Background()); err != nil {
+			t.Fatalf("Expected warm-up to succeed, got %v", err)
+		}
+		if len(requested) != 1 || requested[0] != "/openid/v1/jwks" {
+			t.Errorf("Expected only the JWKS to be fetched, got %v", requested)
+		}
+		if _, found := app.cache.GetStaleEntry("/.well-known/openid-configuration"); found {
+			t.Error("Expected discovery not to be cached")
+		}
+	})
+	t.Run("Retries back off exponentially", func(t *testing.T) {
+		var attempts []time.Time
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, WarmupBackoffInitialMS: 20, WarmupBackoffMaxMS: 1000},
+			cache:  NewCache(60 * time.Second),
+			upstreamClient: newTestUpstreamClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/.well-known/openid-configuration" {
+					attempts = append(attempts, time.Now())
+				}
+				if len(attempts) < 4 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				oidcUpstreamHandler(w, r)
+			}),
+		}
+		captureLogs(t)
+
+		if err := app.WarmUp(context.Background()); err != nil {
+			t.Fatalf("Expected warm-up to succeed, got %v", err)
+		}
+		if len(attempts) != 4 {
+			t.Fatalf("Expected 4 attempts, got %d", len(attempts))
+		}
+		// Delays of 20ms, 40ms and 80ms between attempts
+		for i, minimum := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+			if gap := attempts[i+1].Sub(attempts[i]); gap < minimum {
+				t.Errorf("Expected retry %d after at least %v, got %v", i+1, minimum, gap)
+			}
+		}
+	})
+}
+
+func TestRejectUntilWarm(t *testing.T) {
+	app := &App{
+		config:         &Config{CacheTTLSeconds: 60, RejectUntilWarm: true, WarmupBackoffInitialMS: 3000},
+		cache:          NewCache(60 * time.Second),
+		upstreamClient: newTestUpstreamClient(t, oidcUpstreamHandler),
+	}
+	captureLogs(t)
+
+	cold := httptest.NewRecorder()
+	app.HandleJWKS(cold, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	if cold.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before warm-up, got %d", cold.Code)
+	}
+	if cold.Header().Get("Retry-After") != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", cold.Header().Get("Retry-After"))
+	}
+
+	if err := app.WarmUp(context.Background()); err != nil {
+		t.Fatalf("Expected warm-up to succeed, got %v", err)
+	}
+
+	warm := httptest.NewRecorder()
+	app.HandleJWKS(warm, httptest.NewRequest(http.MethodGet, "/openid/v1/jwks", nil))
+	if warm.Code != http.StatusOK {
+		t.Errorf("Expected 200 after warm-up, got %d", warm.Code)
+	}
+}
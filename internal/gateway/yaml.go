@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// yamlContentType is the media type of YAML discovery responses (RFC 9512)
+const yamlContentType = "application/yaml"
+
+// yamlCache holds the YAML form of the most recently converted discovery document,
+// so conversion happens once per document rather than once per request
+type yamlCache struct {
+	mu   sync.Mutex
+	etag string
+	body []byte
+}
+
+// get returns the YAML form of a cached JSON entry, converting it if the entry changed
+func (c *yamlCache) get(entry CacheEntry) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.body != nil && c.etag == entry.ETag {
+		return c.body, nil
+	}
+
+	body, err := jsonToYAML(entry.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.etag, c.body = entry.ETag, body
+	return body, nil
+}
+
+// wantsYAML reports whether a discovery request asked for YAML, through ?format=yaml
+// or an Accept header naming a YAML media type
+func (a *App) wantsYAML(r *http.Request, path string) bool {
+	if !a.config.DiscoveryYAMLEnabled || path != discoveryPath {
+		return false
+	}
+	if strings.EqualFold(r.URL.Query().Get("format"), "yaml") {
+		return true
+	}
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			switch strings.ToLower(strings.TrimSpace(mediaType)) {
+			case "application/yaml", "application/x-yaml", "text/yaml":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// yamlETag derives the entity tag of the YAML representation from the JSON one, since
+// the two representations must not share a strong ETag
+func yamlETag(etag string) string {
+	return strings.TrimSuffix(etag, `"`) + `-yaml"`
+}
+
+// jsonToYAML converts a JSON document to block-style YAML. Strings and keys are written
+// as double-quoted scalars, which YAML reads exactly like JSON strings.
+func jsonToYAML(body []byte) ([]byte, error) {
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeYAML(&buf, data, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeYAML writes value as the YAML node following a mapping key or sequence dash
+// at the given indentation depth
+func writeYAML(buf *bytes.Buffer, value any, depth int) error {
+	indent := strings.Repeat("  ", depth)
+
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			return writeYAMLScalar(buf, "{}", depth)
+		}
+		if depth > 0 {
+			buf.WriteString("\n")
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			encodedKey, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(indent)
+			buf.Write(encodedKey)
+			buf.WriteString(":")
+			if err := writeYAML(buf, v[key], depth+1); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			return writeYAMLScalar(buf, "[]", depth)
+		}
+		if depth > 0 {
+			buf.WriteString("\n")
+		}
+		for _, item := range v {
+			buf.WriteString(indent)
+			buf.WriteString("-")
+			if err := writeYAML(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return writeYAMLScalar(buf, string(encoded), depth)
+	}
+
+	return nil
+}
+
+// writeYAMLScalar writes an inline value; a top-level scalar forms the whole document
+func writeYAMLScalar(buf *bytes.Buffer, scalar string, depth int) error {
+	if depth > 0 {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(scalar)
+	buf.WriteString("\n")
+	return nil
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJSONToYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"Nested document",
+			`{"issuer":"https://kubernetes.default.svc","jwks_uri":"https://x/openid/v1/jwks","claims":[],"n":12345678901234567890,"ok":true,"meta":{"a":null,"list":["x",{"k":"v"}]}}`,
+			"\"claims\": []\n" +
+				"\"issuer\": \"https://kubernetes.default.svc\"\n" +
+				"\"jwks_uri\": \"https://x/openid/v1/jwks\"\n" +
+				"\"meta\":\n" +
+				"  \"a\": null\n" +
+				"  \"list\":\n" +
+				"    - \"x\"\n" +
+				"    -\n" +
+				"      \"k\": \"v\"\n" +
+				"\"n\": 12345678901234567890\n" +
+				"\"ok\": true\n",
+		},
+		{"Empty object", `{}`, "{}\n"},
+		{"Strings needing escapes", `{"s":"line\nbreak: \"quoted\""}`, "\"s\": \"line\\nbreak: \\\"quoted\\\"\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := jsonToYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Invalid JSON is rejected", func(t *testing.T) {
+		if _, err := jsonToYAML([]byte(`{`)); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
+
+func TestDiscoveryYAML(t *testing.T) {
+	newApp := func(enabled bool) *App {
+		app := &App{
+			config: &Config{CacheTTLSeconds: 60, ClientCacheTTLSeconds: 60, DiscoveryYAMLEnabled: enabled},
+			cache:  NewCache(60 * time.Second),
+		}
+		app.cache.Set("/.well-known/openid-configuration", []byte(`{"issuer":"x"}`), `"d"`)
+		app.cache.Set("/openid/v1/jwks", []byte(`{"keys":[]}`), `"j"`)
+		return app
+	}
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		target      string
+		accept      string
+		expectYAML  bool
+		handlerJWKS bool
+	}{
+		{"JSON by default", true, "/.well-known/openid-configuration", "", false, false},
+		{"Format query", true, "/.well-known/openid-configuration?format=yaml", "", true, false},
+		{"Accept header", true, "/.well-known/openid-configuration", "text/html, application/yaml;q=0.9", true, false},
+		{"Disabled ignores the request", false, "/.well-known/openid-configuration?format=yaml", "", false, false},
+		{"JWKS stays JSON", true, "/openid/v1/jwks?format=yaml", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(tt.enabled)
+			captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			if tt.handlerJWKS {
+				app.HandleJWKS(w, req)
+			} else {
+				app.HandleOIDCDiscovery(w, req)
+			}
+
+			isYAML := w.Header().Get("Content-Type") == yamlContentType
+			if isYAML != tt.expectYAML {
+				t.Fatalf("Expected YAML=%v, got Content-Type %q", tt.expectYAML, w.Header().Get("Content-Type"))
+			}
+			if tt.expectYAML {
+				if w.Body.String() != "\"issuer\": \"x\"\n" {
+					t.Errorf("Unexpected YAML body %q", w.Body.String())
+				}
+				if w.Header().Get("ETag") != `"d-yaml"` {
+					t.Errorf("Expected distinct YAML ETag, got %q", w.Header().Get("ETag"))
+				}
+			}
+		})
+	}
+
+	t.Run("Converted form is reused", func(t *testing.T) {
+		app := newApp(true)
+		captureLogs(t)
+		for i := 0; i < 2; i++ {
+			app.HandleOIDCDiscovery(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration?format=yaml", nil))
+		}
+		first := app.yaml.body
+		app.HandleOIDCDiscovery(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration?format=yaml", nil))
+		if &first[0] != &app.yaml.body[0] {
+			t.Error("Expected the cached YAML body to be reused")
+		}
+	})
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"sync"
 	"syscall"
 	"time"
 
@@ -28,56 +30,126 @@ func main() {
 	}
 
 	// Log the version
-	log.Printf("kube-oidc-gateway version: %s", Version)
+	slog.Info("kube-oidc-gateway version", "version", Version)
 
 	// Load configuration
 	config := gateway.LoadConfig()
+	config.Version = Version
 
-	// Set up logging
-	log.SetFlags(log.LstdFlags | log.LUTC)
-	log.Printf("Starting kube-oidc-gateway")
-	log.Printf("Config: listen=%s:%s upstream=%s cache_ttl=%ds pretty_print=%v",
-		config.ListenAddr, config.ListenPort, config.UpstreamHost,
-		config.CacheTTLSeconds, config.PrettyPrintJSON)
+	// Set up structured logging in the configured format and level
+	gateway.ConfigureLogging(config)
+	slog.Info("Starting kube-oidc-gateway")
+	slog.Info("Config",
+		"listen", config.ListenAddr+":"+config.ListenPort, "upstream", config.UpstreamHost,
+		"cache_ttl_seconds", config.CacheTTLSeconds, "pretty_print", config.PrettyPrintJSON)
 
 	// Create application
 	app, err := gateway.NewApp(config)
 	if err != nil {
-		log.Printf("Failed to initialize application: %v", err)
+		slog.Error("Failed to initialize application", "error", err)
 		os.Exit(1)
 	}
 
+	// Optionally warm the cache before accepting connections so the first request is a hit
+	if config.ListenAfterWarmup {
+		ctx, cancel := context.WithTimeout(context.Background(), config.GetWarmupTimeout())
+		err := app.WarmUp(ctx)
+		cancel()
+		if err != nil {
+			slog.Error("Failed to warm cache before listening", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Start background tasks, stopped when the server shuts down
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	app.StartStatsLogger(bgCtx)
+	app.StartIntegrityChecker(bgCtx)
+	app.StartMetricsFlusher(bgCtx)
+
+	// Without a start-up warm-up, OIDC requests are refused until this background one succeeds
+	if config.RejectUntilWarm && !config.ListenAfterWarmup {
+		go func() {
+			if err := app.WarmUp(bgCtx); err != nil {
+				slog.Warn("Background cache warm-up stopped", "error", err)
+			}
+		}()
+	}
+
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 
-	// OIDC endpoints
-	mux.HandleFunc("/.well-known/openid-configuration", app.HandleOIDCDiscovery)
-	mux.HandleFunc("/openid/v1/jwks", app.HandleJWKS)
+	// OIDC endpoints, unless disabled to minimize exposed surface
+	if config.IsEndpointEnabled(gateway.EndpointDiscovery) {
+		mux.HandleFunc("/.well-known/openid-configuration", app.HandleOIDCDiscovery)
+	}
+	if config.IsEndpointEnabled(gateway.EndpointJWKS) {
+		mux.HandleFunc("/openid/v1/jwks", app.HandleJWKS)
+	}
 
 	// Health endpoints
 	mux.HandleFunc("/healthz", app.HandleHealthz)
 	mux.HandleFunc("/readyz", app.HandleReadyz)
 
+	// Debug endpoints, only registered when a debug token is configured
+	if config.DebugAuthToken != "" {
+		mux.HandleFunc("/debug/jwks/diff", app.RequireDebugAuth(app.HandleJWKSDiff))
+		if config.CacheSnapshotEnabled {
+			mux.HandleFunc("/debug/cache/snapshot", app.RequireDebugAuth(app.HandleCacheSnapshot))
+		}
+	}
+
+	// Status endpoint, only registered when enabled since it exposes internals
+	if config.StatusEndpointEnabled {
+		mux.HandleFunc("/status", app.HandleStatus)
+	}
+
+	// Stats endpoint, for basic observability without a metrics stack
+	if config.StatsEndpointEnabled {
+		mux.HandleFunc("/stats", app.HandleStats)
+	}
+
+	// Prometheus metrics endpoint, only registered when enabled
+	if config.MetricsEnabled {
+		mux.HandleFunc("/metrics", app.HandleMetrics)
+	}
+
 	// Catch-all for 404
 	mux.HandleFunc("/", app.HandleNotFound)
 
-	// Create HTTP server with timeouts
-	addr := fmt.Sprintf("%s:%s", config.ListenAddr, config.ListenPort)
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second,
-		ReadTimeout:       30 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
+	// Reject scanner probes (TRACE, CONNECT and oversized URLs) before routing, and flag deprecated paths
+	handler := app.RejectTraceConnect(app.LimitURLLength(app.RestrictHosts(app.WarnDeprecatedPaths(mux))))
+
+	// Create HTTP servers with timeouts, optionally on a secondary port to ease port migrations
+	servers := []*http.Server{
+		newServer(fmt.Sprintf("%s:%s", config.ListenAddr, config.ListenPort), handler),
+	}
+	if config.SecondaryListenPort != "" {
+		servers = append(servers, newServer(fmt.Sprintf("%s:%s", config.ListenAddr, config.SecondaryListenPort), handler))
+	}
+
+	// Start servers in goroutines
+	serverErrors := make(chan error, len(servers))
+	for _, server := range servers {
+		listener, err := gateway.NewListener(server.Addr, config)
+		if err != nil {
+			slog.Error("Failed to listen", "addr", server.Addr, "error", err)
+			os.Exit(1)
+		}
+
+		go func(server *http.Server, listener net.Listener) {
+			slog.Info("Listening", "addr", server.Addr)
+			serverErrors <- server.Serve(listener)
+		}(server, listener)
 	}
 
-	// Start server in a goroutine
-	serverErrors := make(chan error, 1)
-	go func() {
-		log.Printf("Listening on %s", addr)
-		serverErrors <- server.ListenAndServe()
-	}()
+	// Reload runtime-configurable settings on SIGHUP, one reload at a time
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go handleReloads(reload, func() {
+		app.Reload(gateway.LoadConfig())
+	})
 
 	// Listen for shutdown signals
 	shutdown := make(chan os.Signal, 1)
@@ -86,25 +158,107 @@ func main() {
 	// Block until a signal is received or server error
 	select {
 	case err := <-serverErrors:
-		log.Printf("Server error: %v", err)
+		slog.Error("Server error", "error", err)
 		os.Exit(1)
 	case sig := <-shutdown:
-		log.Printf("Received shutdown signal: %v. Starting graceful shutdown...", sig)
+		slog.Info("Received shutdown signal, starting graceful shutdown", "signal", sig.String())
+		stopBackground()
 
 		// Give outstanding requests a deadline for completion
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		// Perform graceful shutdown
-		if err := server.Shutdown(ctx); err != nil {
-			log.Printf("Graceful shutdown failed: %v", err)
+		// A further SIGINT during the drain (Ctrl+C twice in local development) skips the wait
+		go cancelOnInterrupt(shutdown, cancel)
+
+		// Perform graceful shutdown of all listeners together, recording how many requests drained
+		slog.Info("shutdown_drain_start", "in_flight", app.InFlightRequests())
+		err := shutdownServers(ctx, servers)
+		slog.Info("shutdown_drain_end", "in_flight", app.InFlightRequests(), "drained", err == nil)
+
+		// Send batched metrics recorded up to the end of the drain
+		app.FlushMetrics()
+		if err != nil {
+			slog.Error("Graceful shutdown failed", "error", err, "shutdown_path", "forced")
 			// Force close
-			if err := server.Close(); err != nil {
-				log.Printf("Failed to close server: %v", err)
+			for _, server := range servers {
+				if err := server.Close(); err != nil {
+					slog.Error("Failed to close server", "error", err)
+				}
 			}
 			os.Exit(1)
 		}
 
-		log.Printf("Graceful shutdown completed")
+		slog.Info("Graceful shutdown completed", "shutdown_path", "graceful")
+	}
+}
+
+// cancelOnInterrupt cancels the shutdown context when a SIGINT arrives, so that a
+// second Ctrl+C forces an immediate close; SIGTERM never interrupts the drain
+func cancelOnInterrupt(signals <-chan os.Signal, cancel context.CancelFunc) {
+	for sig := range signals {
+		if sig == os.Interrupt {
+			slog.Warn("Received second signal, forcing immediate shutdown", "signal", sig.String())
+			cancel()
+			return
+		}
+		slog.Info("Received signal during shutdown, continuing graceful drain", "signal", sig.String())
+	}
+}
+
+// handleReloads runs reload for each SIGHUP, strictly one after another. Signals that
+// queue up while a reload runs are coalesced into a single follow-up reload, so a burst
+// of signals never overlaps reloads or replays them one by one.
+func handleReloads(signals <-chan os.Signal, reload func()) {
+	for range signals {
+		coalesced := 0
+	drain:
+		for {
+			select {
+			case _, ok := <-signals:
+				if !ok {
+					break drain
+				}
+				coalesced++
+			default:
+				break drain
+			}
+		}
+
+		slog.Info("Received SIGHUP, reloading configuration", "coalesced", coalesced)
+		reload()
+	}
+}
+
+// newServer creates an HTTP server with production timeouts, logging its connection
+// errors through the default slog handler at warning level
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// shutdownServers gracefully shuts down all servers concurrently, returning the first error
+func shutdownServers(ctx context.Context, servers []*http.Server) error {
+	errs := make(chan error, len(servers))
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				errs <- fmt.Errorf("%s: %w", server.Addr, err)
+			}
+		}(server)
 	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -28,14 +29,7 @@ func TestServerTimeouts(t *testing.T) {
 			w.Write([]byte("OK"))
 		})
 
-		server := &http.Server{
-			Addr:              config.ListenAddr + ":" + config.ListenPort,
-			Handler:           mux,
-			ReadHeaderTimeout: 10 * time.Second,
-			ReadTimeout:       30 * time.Second,
-			WriteTimeout:      30 * time.Second,
-			IdleTimeout:       120 * time.Second,
-		}
+		server := newServer(config.ListenAddr+":"+config.ListenPort, mux)
 
 		// Verify timeouts are set correctly
 		if server.ReadHeaderTimeout != 10*time.Second {
@@ -113,3 +107,132 @@ func TestSignalHandling(t *testing.T) {
 		// If we got here without panic, the signal setup works
 	})
 }
+
+func TestShutdownServers(t *testing.T) {
+	t.Run("Primary and secondary servers shut down together", func(t *testing.T) {
+		mux := http.NewServeMux()
+		servers := []*http.Server{
+			newServer("127.0.0.1:0", mux),
+			newServer("127.0.0.1:0", mux),
+		}
+
+		serverErrors := make(chan error, len(servers))
+		for _, server := range servers {
+			go func(server *http.Server) {
+				serverErrors <- server.ListenAndServe()
+			}(server)
+		}
+
+		// Give servers time to start
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownServers(ctx, servers); err != nil {
+			t.Errorf("Expected graceful shutdown to succeed, got error: %v", err)
+		}
+
+		for range servers {
+			if err := <-serverErrors; err != http.ErrServerClosed {
+				t.Errorf("Expected ErrServerClosed, got %v", err)
+			}
+		}
+	})
+}
+
+func TestCancelOnInterrupt(t *testing.T) {
+	t.Run("SIGINT cancels the drain", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			cancelOnInterrupt(signals, cancel)
+			close(done)
+		}()
+
+		signals <- syscall.SIGINT
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected cancelOnInterrupt to return after SIGINT")
+		}
+		if ctx.Err() == nil {
+			t.Error("Expected context to be cancelled")
+		}
+	})
+
+	t.Run("SIGTERM does not cancel the drain", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			cancelOnInterrupt(signals, cancel)
+			close(done)
+		}()
+
+		signals <- syscall.SIGTERM
+		close(signals)
+		<-done
+
+		if ctx.Err() != nil {
+			t.Error("Expected context not to be cancelled by SIGTERM")
+		}
+	})
+}
+
+func TestHandleReloads(t *testing.T) {
+	t.Run("Rapid signals are coalesced and never overlap", func(t *testing.T) {
+		signals := make(chan os.Signal, 8)
+		var active, maxActive, calls atomic.Int32
+		started := make(chan struct{}, 1)
+		reload := func() {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			current := active.Add(1)
+			if current > maxActive.Load() {
+				maxActive.Store(current)
+			}
+			calls.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			active.Add(-1)
+		}
+
+		// A burst queued before the handler runs collapses into a single reload
+		for i := 0; i < 5; i++ {
+			signals <- syscall.SIGHUP
+		}
+
+		done := make(chan struct{})
+		go func() {
+			handleReloads(signals, reload)
+			close(done)
+		}()
+
+		// Signals arriving during that reload queue exactly one follow-up
+		<-started
+		for i := 0; i < 3; i++ {
+			signals <- syscall.SIGHUP
+		}
+		close(signals)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected handleReloads to return when the channel closes")
+		}
+		if maxActive.Load() != 1 {
+			t.Errorf("Expected reloads never to overlap, got %d concurrent", maxActive.Load())
+		}
+		if calls.Load() != 2 {
+			t.Errorf("Expected 2 coalesced reloads, got %d", calls.Load())
+		}
+	})
+}